@@ -0,0 +1,238 @@
+// Code generated by bsongen -type Event,Location. DO NOT EDIT.
+
+package example
+
+import "github.com/garyburd/go-mongo/mongo"
+
+// MarshalBSON implements the mongo.DocumentMarshaler interface.
+func (v Event) MarshalBSON() ([]byte, error) {
+	return v.appendBSON(nil)
+}
+
+func (v Event) appendBSON(buf []byte) ([]byte, error) {
+	var err error
+	buf, offset := mongo.AppendDocumentStart(buf)
+	if v.Id != "" {
+		if buf, err = mongo.AppendObjectIdElement(buf, "_id", v.Id); err != nil {
+			return nil, err
+		}
+	}
+	buf = mongo.AppendStringElement(buf, "name", v.Name)
+	if v.Kind != "" {
+		buf = mongo.AppendStringElement(buf, "kind", v.Kind)
+	}
+	buf = mongo.AppendBoolElement(buf, "active", v.Active)
+	buf = mongo.AppendIntElement(buf, "count", int64(v.Count))
+	if v.Small != 0 {
+		buf = mongo.AppendInt32Element(buf, "small", v.Small)
+	}
+	buf = mongo.AppendInt64Element(buf, "big", v.Big)
+	buf = mongo.AppendIntElement(buf, "min", v.Min)
+	buf = mongo.AppendInt32Element(buf, "port", int32(v.Port))
+	buf = mongo.AppendDoubleElement(buf, "score", v.Score)
+	buf = mongo.AppendDateTimeElement(buf, "created", v.Created)
+	if !v.Updated.IsZero() {
+		buf = mongo.AppendDateTimeElement(buf, "updated", v.Updated)
+	}
+	if v.Payload != nil {
+		buf = mongo.AppendBinaryElement(buf, "payload", mongo.BinaryGeneric, v.Payload)
+	}
+	if v.Tags != nil {
+		if buf, err = mongo.AppendElement(buf, "tags", v.Tags, true); err != nil {
+			return nil, err
+		}
+	}
+	buf = mongo.AppendElementName(buf, mongo.KindDocument, "where")
+	if buf, err = v.Where.appendBSON(buf); err != nil {
+		return nil, err
+	}
+	if v.Previous != nil {
+		buf = mongo.AppendElementName(buf, mongo.KindDocument, "previous")
+		if buf, err = v.Previous.appendBSON(buf); err != nil {
+			return nil, err
+		}
+	}
+	if buf, err = mongo.AppendElement(buf, "note", v.Note, false); err != nil {
+		return nil, err
+	}
+	if buf, err = mongo.AppendElement(buf, "extra", v.Extra, true); err != nil {
+		return nil, err
+	}
+	return mongo.AppendDocumentEnd(buf, offset), nil
+}
+
+// UnmarshalBSON implements the mongo.DocumentUnmarshaler interface.
+func (v *Event) UnmarshalBSON(data []byte) error {
+	var firstErr error
+	err := mongo.Raw(data).ForEach(func(key []byte, bd mongo.BSONData) error {
+		if err := v.unmarshalBSONElement(key, bd); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return firstErr
+}
+
+func (v *Event) unmarshalBSONElement(key []byte, bd mongo.BSONData) error {
+	if (bd.Kind == mongo.KindNull || bd.Kind == mongo.KindUndefined) && string(key) != "note" {
+		return nil
+	}
+	switch string(key) {
+	case "_id":
+		if x, ok := bd.ObjectIdOK(); ok {
+			v.Id = x
+			return nil
+		}
+		return bd.Decode(&v.Id)
+	case "active":
+		if x, ok := bd.BoolOK(); ok {
+			v.Active = x
+			return nil
+		}
+		return bd.Decode(&v.Active)
+	case "big":
+		if x, ok := bd.Int32OK(); ok {
+			v.Big = int64(x)
+			return nil
+		}
+		if x, ok := bd.Int64OK(); ok {
+			v.Big = x
+			return nil
+		}
+		return bd.Decode(&v.Big)
+	case "count":
+		if x, ok := bd.Int32OK(); ok {
+			v.Count = int(x)
+			return nil
+		}
+		return bd.Decode(&v.Count)
+	case "created":
+		if x, ok := bd.TimeOK(); ok {
+			v.Created = x
+			return nil
+		}
+		return bd.Decode(&v.Created)
+	case "extra":
+		return bd.Decode(&v.Extra)
+	case "kind":
+		if x, ok := bd.StringOK(); ok {
+			v.Kind = x
+			return nil
+		}
+		return bd.Decode(&v.Kind)
+	case "min":
+		if x, ok := bd.Int32OK(); ok {
+			v.Min = int64(x)
+			return nil
+		}
+		if x, ok := bd.Int64OK(); ok {
+			v.Min = x
+			return nil
+		}
+		return bd.Decode(&v.Min)
+	case "name":
+		if x, ok := bd.StringOK(); ok {
+			v.Name = x
+			return nil
+		}
+		return bd.Decode(&v.Name)
+	case "note":
+		return bd.Decode(&v.Note)
+	case "payload":
+		return bd.Decode(&v.Payload)
+	case "port":
+		return bd.Decode(&v.Port)
+	case "previous":
+		if bd.Kind == mongo.KindDocument {
+			if v.Previous == nil {
+				v.Previous = new(Location)
+			}
+			return v.Previous.UnmarshalBSON(bd.Data)
+		}
+		return bd.Decode(&v.Previous)
+	case "score":
+		if x, ok := bd.DoubleOK(); ok {
+			v.Score = x
+			return nil
+		}
+		return bd.Decode(&v.Score)
+	case "small":
+		if x, ok := bd.Int32OK(); ok {
+			v.Small = x
+			return nil
+		}
+		return bd.Decode(&v.Small)
+	case "tags":
+		return bd.Decode(&v.Tags)
+	case "updated":
+		if x, ok := bd.TimeOK(); ok {
+			v.Updated = x
+			return nil
+		}
+		return bd.Decode(&v.Updated)
+	case "where":
+		if bd.Kind == mongo.KindDocument {
+			return v.Where.UnmarshalBSON(bd.Data)
+		}
+		return bd.Decode(&v.Where)
+	}
+	return nil
+}
+
+// MarshalBSON implements the mongo.DocumentMarshaler interface.
+func (v Location) MarshalBSON() ([]byte, error) {
+	return v.appendBSON(nil)
+}
+
+func (v Location) appendBSON(buf []byte) ([]byte, error) {
+	buf, offset := mongo.AppendDocumentStart(buf)
+	buf = mongo.AppendStringElement(buf, "city", v.City)
+	buf = mongo.AppendDoubleElement(buf, "lat", v.Lat)
+	buf = mongo.AppendDoubleElement(buf, "lng", v.Lng)
+	return mongo.AppendDocumentEnd(buf, offset), nil
+}
+
+// UnmarshalBSON implements the mongo.DocumentUnmarshaler interface.
+func (v *Location) UnmarshalBSON(data []byte) error {
+	var firstErr error
+	err := mongo.Raw(data).ForEach(func(key []byte, bd mongo.BSONData) error {
+		if err := v.unmarshalBSONElement(key, bd); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return firstErr
+}
+
+func (v *Location) unmarshalBSONElement(key []byte, bd mongo.BSONData) error {
+	if bd.Kind == mongo.KindNull || bd.Kind == mongo.KindUndefined {
+		return nil
+	}
+	switch string(key) {
+	case "city":
+		if x, ok := bd.StringOK(); ok {
+			v.City = x
+			return nil
+		}
+		return bd.Decode(&v.City)
+	case "lat":
+		if x, ok := bd.DoubleOK(); ok {
+			v.Lat = x
+			return nil
+		}
+		return bd.Decode(&v.Lat)
+	case "lng":
+		if x, ok := bd.DoubleOK(); ok {
+			v.Lng = x
+			return nil
+		}
+		return bd.Decode(&v.Lng)
+	}
+	return nil
+}
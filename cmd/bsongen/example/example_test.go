@@ -0,0 +1,232 @@
+// Copyright 2011 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package example
+
+import (
+	"bytes"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/garyburd/go-mongo/mongo"
+)
+
+// reflectEvent and reflectLocation have the same fields as Event and
+// Location, but do not have the generated methods.
+type reflectLocation struct {
+	City string  `bson:"city"`
+	Lat  float64 `bson:"lat"`
+	Lng  float64 `bson:"lng"`
+}
+
+type reflectEvent struct {
+	Id       mongo.ObjectId         `bson:"_id"`
+	Name     string                 `bson:"name"`
+	Kind     string                 `bson:"kind,omitempty"`
+	Active   bool                   `bson:"active"`
+	Count    int                    `bson:"count"`
+	Small    int32                  `bson:"small,omitempty"`
+	Big      int64                  `bson:"big"`
+	Min      int64                  `bson:"min,minsize"`
+	Port     uint16                 `bson:"port"`
+	Score    float64                `bson:"score"`
+	Created  time.Time              `bson:"created"`
+	Updated  time.Time              `bson:"updated,omitempty"`
+	Payload  []byte                 `bson:"payload"`
+	Tags     []string               `bson:"tags,omitempty"`
+	Where    reflectLocation        `bson:"where"`
+	Previous *reflectLocation       `bson:"previous,omitempty"`
+	Note     mongo.Nullable[string] `bson:"note"`
+	Extra    mongo.M                `bson:"extra,omitempty"`
+}
+
+var parityTests = []reflectEvent{
+	{},
+	{
+		Id:       mongo.ObjectId("\x01\x02\x03\x04\x05\x06\x07\x08\x09\x0a\x0b\x0c"),
+		Name:     "login",
+		Kind:     "auth",
+		Active:   true,
+		Count:    math.MaxInt32 + 1,
+		Small:    -7,
+		Big:      3,
+		Min:      4,
+		Port:     8080,
+		Score:    1.5,
+		Created:  time.Unix(1300000000, 123000000).UTC(),
+		Updated:  time.Unix(1300000001, 0).UTC(),
+		Payload:  []byte("data"),
+		Tags:     []string{"a", "b"},
+		Where:    reflectLocation{"Portland", 45.5, -122.7},
+		Previous: &reflectLocation{City: "Seattle"},
+		Note:     mongo.NewNullable("hello"),
+		Extra:    mongo.M{"x": 1},
+	},
+	{Count: -1, Min: math.MaxInt64, Payload: []byte{}, Note: mongo.Nullable[string]{Present: true}},
+}
+
+func TestParity(t *testing.T) {
+	for _, r := range parityTests {
+		expected, err := mongo.Encode(nil, r)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		e := Event{}
+		if err := mongo.Decode(expected, &e); err != nil {
+			t.Errorf("Decode(%v) returned error %v", r, err)
+			continue
+		}
+		actual, err := mongo.Encode(nil, e)
+		if err != nil {
+			t.Errorf("Encode(%v) returned error %v", e, err)
+			continue
+		}
+		if !bytes.Equal(actual, expected) {
+			t.Errorf("Encode(%v)\n got %q\nwant %q", e, actual, expected)
+		}
+
+		var r2 reflectEvent
+		if err := mongo.Decode(actual, &r2); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(r2, r) && !(r2.Payload != nil && len(r.Payload) == 0) {
+			t.Errorf("round trip = %+v, want %+v", r2, r)
+		}
+	}
+}
+
+func TestDecodeConversions(t *testing.T) {
+	data, _ := mongo.Encode(nil, mongo.M{
+		"name":    mongo.BSONData{Kind: mongo.KindNull},
+		"count":   int64(5),
+		"big":     2.0,
+		"score":   3,
+		"port":    int64(80),
+		"note":    mongo.BSONData{Kind: mongo.KindNull},
+		"unknown": "x",
+	})
+	e := Event{Name: "keep"}
+	if err := mongo.Decode(data, &e); err != nil {
+		t.Fatal(err)
+	}
+	if e.Name != "keep" || e.Count != 5 || e.Big != 2 || e.Score != 3 || e.Port != 80 || e.Note != (mongo.Nullable[string]{Present: true}) {
+		t.Errorf("Decode() = %+v", e)
+	}
+
+	data, _ = mongo.Encode(nil, mongo.M{"score": "x"})
+	if err := mongo.Decode(data, &e); err == nil {
+		t.Error("Decode of string to float64 did not return error")
+	}
+}
+
+func TestDecodeErrorParity(t *testing.T) {
+	for _, doc := range []mongo.M{
+		{"count": "x", "name": "y"},
+		{"name": 1, "score": "z", "big": int64(7)},
+		{"where": mongo.M{"city": 1}, "tags": mongo.A{"a"}},
+		{"where": mongo.M{"city": 2, "lat": 1.5}, "port": "p", "kind": "k"},
+		{"_id": "bad", "active": true},
+	} {
+		data, err := mongo.Encode(nil, doc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var e Event
+		var r reflectEvent
+		errGenerated := mongo.Decode(data, &e)
+		errReflect := mongo.Decode(data, &r)
+		if (errGenerated == nil) != (errReflect == nil) {
+			t.Errorf("Decode(%v) returned %v, reflective decoder returned %v", doc, errGenerated, errReflect)
+		}
+		actual, _ := mongo.Encode(nil, e)
+		expected, _ := mongo.Encode(nil, r)
+		if !bytes.Equal(actual, expected) {
+			t.Errorf("Decode(%v)\n got %+v\nwant %+v", doc, e, r)
+		}
+	}
+
+	// Malformed documents.
+	data, _ := mongo.Encode(nil, mongo.M{"name": "x", "count": 1})
+	for _, p := range [][]byte{data[:len(data)-3], append(data[:4:4], 0x7e)} {
+		var e Event
+		var r reflectEvent
+		if err := mongo.Decode(p, &e); err == nil {
+			t.Errorf("Decode(%q) did not return error", p)
+		}
+		if err := mongo.Decode(p, &r); err == nil {
+			t.Errorf("reflective Decode(%q) did not return error", p)
+		}
+	}
+}
+
+var benchmarkEvent = reflectEvent{
+	Id:      mongo.ObjectId("\x01\x02\x03\x04\x05\x06\x07\x08\x09\x0a\x0b\x0c"),
+	Name:    "login",
+	Active:  true,
+	Count:   42,
+	Big:     1 << 40,
+	Score:   1.5,
+	Created: time.Unix(1300000000, 0).UTC(),
+	Payload: []byte("data"),
+	Where:   reflectLocation{"Portland", 45.5, -122.7},
+}
+
+func BenchmarkEncodeGenerated(b *testing.B) {
+	var v Event
+	data, _ := mongo.Encode(nil, benchmarkEvent)
+	if err := mongo.Decode(data, &v); err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := mongo.Encode(nil, v); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkEncodeReflect(b *testing.B) {
+	v := benchmarkEvent
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := mongo.Encode(nil, v); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDecodeGenerated(b *testing.B) {
+	data, _ := mongo.Encode(nil, benchmarkEvent)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		var v Event
+		if err := mongo.Decode(data, &v); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDecodeReflect(b *testing.B) {
+	data, _ := mongo.Encode(nil, benchmarkEvent)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		var v reflectEvent
+		if err := mongo.Decode(data, &v); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
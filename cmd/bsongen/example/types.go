@@ -0,0 +1,55 @@
+// Copyright 2011 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+// Package example contains types with methods generated by bsongen. The tests
+// in this package compare the generated methods with the reflective encoder
+// and decoder.
+package example
+
+import (
+	"time"
+
+	"github.com/garyburd/go-mongo/mongo"
+)
+
+//go:generate go run github.com/garyburd/go-mongo/cmd/bsongen -type Event,Location
+
+type Event struct {
+	Id       mongo.ObjectId         `bson:"_id"`
+	Name     string                 `bson:"name"`
+	Kind     string                 `bson:"kind,omitempty"`
+	Active   bool                   `bson:"active"`
+	Count    int                    `bson:"count"`
+	Small    int32                  `bson:"small,omitempty"`
+	Big      int64                  `bson:"big"`
+	Min      int64                  `bson:"min,minsize"`
+	Port     uint16                 `bson:"port"`
+	Score    float64                `bson:"score"`
+	Created  time.Time              `bson:"created"`
+	Updated  time.Time              `bson:"updated,omitempty"`
+	Payload  []byte                 `bson:"payload"`
+	Tags     []string               `bson:"tags,omitempty"`
+	Where    Location               `bson:"where"`
+	Previous *Location              `bson:"previous,omitempty"`
+	Note     mongo.Nullable[string] `bson:"note"`
+	Extra    mongo.M                `bson:"extra,omitempty"`
+	internal int
+	Ignored  string `bson:"-"`
+}
+
+type Location struct {
+	City string  `bson:"city"`
+	Lat  float64 `bson:"lat"`
+	Lng  float64 `bson:"lng"`
+}
@@ -0,0 +1,376 @@
+// Copyright 2011 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+// Command bsongen generates MarshalBSON and UnmarshalBSON methods for struct
+// types. The mongo package uses these methods in place of the reflective
+// encoder and decoder.
+//
+// Usage:
+//
+//	//go:generate bsongen -type Event,Session
+//
+// The generated methods encode and decode fields of type string, bool, int,
+// int8, int16, int32, int64, uint8, uint16, uint32, float32, float64,
+// time.Time, []byte and mongo.ObjectId directly. Fields of other types are
+// encoded and decoded with the reflective encoder, which uses generated
+// methods of nested types. The encoding is the same as the reflective
+// encoding of the struct.
+//
+// The omitempty and minsize field flags are supported. Structs with embedded
+// fields or fields with other flags are rejected.
+//
+// Encode and decode options do not apply to types with generated methods
+// because the options are not passed to MarshalBSON and UnmarshalBSON. Use
+// the reflective encoder and decoder with a type that does not have the
+// generated methods when options such as Registry, Strict, PreserveNulls,
+// Location or StrictPrecision are needed.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	typeNames = flag.String("type", "", "comma separated list of type names; required")
+	output    = flag.String("output", "", "output file name; default <type>_bson.go")
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: bsongen -type T[,T...] [-output file] [directory]\n")
+	flag.PrintDefaults()
+	os.Exit(2)
+}
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("bsongen: ")
+	flag.Usage = usage
+	flag.Parse()
+	if *typeNames == "" || flag.NArg() > 1 {
+		usage()
+	}
+	dir := "."
+	if flag.NArg() == 1 {
+		dir = flag.Arg(0)
+	}
+	types := strings.Split(*typeNames, ",")
+
+	src, err := generate(dir, types)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	name := *output
+	if name == "" {
+		name = filepath.Join(dir, strings.ToLower(types[0])+"_bson.go")
+	}
+	if err := ioutil.WriteFile(name, src, 0666); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// field describes a struct field in the generated code.
+type field struct {
+	goName    string // name of field in Go struct
+	name      string // name of BSON element
+	typ       string // Go type expression
+	omitEmpty bool
+	minSize   bool
+	generated bool // field type has generated methods
+}
+
+// generate returns the formatted source for the methods of the named types in
+// the package in dir.
+func generate(dir string, types []string) ([]byte, error) {
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, dir, func(fi os.FileInfo) bool {
+		return !strings.HasSuffix(fi.Name(), "_test.go") && !strings.HasSuffix(fi.Name(), "_bson.go")
+	}, 0)
+	if err != nil {
+		return nil, err
+	}
+	if len(pkgs) != 1 {
+		return nil, fmt.Errorf("found %d packages in %s, want 1", len(pkgs), dir)
+	}
+	var pkg *ast.Package
+	for _, p := range pkgs {
+		pkg = p
+	}
+
+	specs := make(map[string]*ast.StructType)
+	for _, file := range pkg.Files {
+		ast.Inspect(file, func(n ast.Node) bool {
+			if ts, ok := n.(*ast.TypeSpec); ok {
+				if st, ok := ts.Type.(*ast.StructType); ok {
+					specs[ts.Name.Name] = st
+				}
+			}
+			return true
+		})
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "// Code generated by bsongen -type %s. DO NOT EDIT.\n\n", strings.Join(types, ","))
+	fmt.Fprintf(&buf, "package %s\n\n", pkg.Name)
+	fmt.Fprintf(&buf, "import \"github.com/garyburd/go-mongo/mongo\"\n")
+
+	generated := make(map[string]bool)
+	for _, name := range types {
+		generated[name] = true
+	}
+
+	for _, name := range types {
+		st, found := specs[name]
+		if !found {
+			return nil, fmt.Errorf("struct type %s not found", name)
+		}
+		fields, err := structFields(fset, name, st)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range fields {
+			f.generated = generated[strings.TrimPrefix(f.typ, "*")]
+		}
+		writeMarshal(&buf, name, fields)
+		writeUnmarshal(&buf, name, fields)
+	}
+
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("internal error: %v\n%s", err, buf.Bytes())
+	}
+	return src, nil
+}
+
+// structFields returns the encoded fields of a struct using the rules in
+// compileStructSpec.
+func structFields(fset *token.FileSet, typeName string, st *ast.StructType) ([]*field, error) {
+	var fields []*field
+	seen := make(map[string]bool)
+	for _, f := range st.Fields.List {
+		if len(f.Names) == 0 {
+			return nil, fmt.Errorf("%s: embedded fields are not supported", typeName)
+		}
+		var typ bytes.Buffer
+		if err := format.Node(&typ, fset, f.Type); err != nil {
+			return nil, err
+		}
+		var tag reflect.StructTag
+		if f.Tag != nil {
+			s, err := strconv.Unquote(f.Tag.Value)
+			if err != nil {
+				return nil, err
+			}
+			tag = reflect.StructTag(s)
+		}
+		for _, ident := range f.Names {
+			if !ident.IsExported() {
+				continue
+			}
+			fd := &field{goName: ident.Name, name: ident.Name, typ: typ.String()}
+			p := strings.Split(tag.Get("bson"), ",")
+			if p[0] == "-" {
+				continue
+			}
+			if p[0] != "" {
+				fd.name = p[0]
+			}
+			for _, s := range p[1:] {
+				switch s {
+				case "omitempty":
+					fd.omitEmpty = true
+				case "minsize":
+					fd.minSize = true
+				default:
+					return nil, fmt.Errorf("%s.%s: field flag %s is not supported", typeName, ident.Name, s)
+				}
+			}
+			if seen[fd.name] {
+				return nil, fmt.Errorf("%s: duplicate element name %s", typeName, fd.name)
+			}
+			seen[fd.name] = true
+			fields = append(fields, fd)
+		}
+	}
+	return fields, nil
+}
+
+// encodeStmt returns a statement that appends field f of v to buf. The
+// encodings match the encoder functions in the mongo package.
+func encodeStmt(f *field) string {
+	v := "v." + f.goName
+	key := strconv.Quote(f.name)
+	conv := func(typ string) string {
+		if f.typ == typ {
+			return v
+		}
+		return typ + "(" + v + ")"
+	}
+	omit := func(zero, stmt string) string {
+		if !f.omitEmpty {
+			return stmt
+		}
+		return "if " + v + " != " + zero + " {\n" + stmt + "\n}"
+	}
+	// The encoder skips nil pointers, slices and maps.
+	nilCheck := func(stmt string) string {
+		if strings.HasPrefix(f.typ, "*") || strings.HasPrefix(f.typ, "[]") || strings.HasPrefix(f.typ, "map[") {
+			return "if " + v + " != nil {\n" + stmt + "\n}"
+		}
+		return stmt
+	}
+	if f.generated {
+		return nilCheck("buf = mongo.AppendElementName(buf, mongo.KindDocument, " + key + ")\nif buf, err = " + v + ".appendBSON(buf); err != nil {\nreturn nil, err\n}")
+	}
+	switch f.typ {
+	case "string":
+		return omit(`""`, "buf = mongo.AppendStringElement(buf, "+key+", "+v+")")
+	case "bool":
+		return omit("false", "buf = mongo.AppendBoolElement(buf, "+key+", "+v+")")
+	case "int", "uint32":
+		return omit("0", "buf = mongo.AppendIntElement(buf, "+key+", "+conv("int64")+")")
+	case "int8", "int16", "int32", "uint8", "uint16":
+		return omit("0", "buf = mongo.AppendInt32Element(buf, "+key+", "+conv("int32")+")")
+	case "int64":
+		if f.minSize {
+			return omit("0", "buf = mongo.AppendIntElement(buf, "+key+", "+v+")")
+		}
+		return omit("0", "buf = mongo.AppendInt64Element(buf, "+key+", "+v+")")
+	case "float32", "float64":
+		return omit("0", "buf = mongo.AppendDoubleElement(buf, "+key+", "+conv("float64")+")")
+	case "time.Time":
+		stmt := "buf = mongo.AppendDateTimeElement(buf, " + key + ", " + v + ")"
+		if f.omitEmpty {
+			return "if !" + v + ".IsZero() {\n" + stmt + "\n}"
+		}
+		return stmt
+	case "[]byte":
+		return nilCheck("buf = mongo.AppendBinaryElement(buf, " + key + ", mongo.BinaryGeneric, " + v + ")")
+	case "mongo.ObjectId":
+		return "if " + v + " != \"\" {\nif buf, err = mongo.AppendObjectIdElement(buf, " + key + ", " + v + "); err != nil {\nreturn nil, err\n}\n}"
+	}
+	return nilCheck("if buf, err = mongo.AppendElement(buf, " + key + ", " + v + ", " + strconv.FormatBool(f.omitEmpty) + "); err != nil {\nreturn nil, err\n}")
+}
+
+func writeMarshal(buf *bytes.Buffer, typeName string, fields []*field) {
+	usesErr := false
+	var body bytes.Buffer
+	for _, f := range fields {
+		stmt := encodeStmt(f)
+		usesErr = usesErr || strings.Contains(stmt, "err")
+		body.WriteString(stmt)
+		body.WriteString("\n")
+	}
+	fmt.Fprintf(buf, "\n// MarshalBSON implements the mongo.DocumentMarshaler interface.\n")
+	fmt.Fprintf(buf, "func (v %s) MarshalBSON() ([]byte, error) {\nreturn v.appendBSON(nil)\n}\n", typeName)
+	fmt.Fprintf(buf, "\nfunc (v %s) appendBSON(buf []byte) ([]byte, error) {\n", typeName)
+	if usesErr {
+		fmt.Fprintf(buf, "var err error\n")
+	}
+	fmt.Fprintf(buf, "buf, offset := mongo.AppendDocumentStart(buf)\n")
+	buf.Write(body.Bytes())
+	fmt.Fprintf(buf, "return mongo.AppendDocumentEnd(buf, offset), nil\n}\n")
+}
+
+// decodeStmts returns the statements that decode value bd to field f of v.
+// The statements handle values that do not need a conversion. Other values
+// are decoded with the reflective decoder.
+func decodeStmts(f *field) string {
+	v := "v." + f.goName
+	fast := func(method, conv string) string {
+		x := "x"
+		if conv != "" {
+			x = conv + "(x)"
+		}
+		return "if x, ok := bd." + method + "(); ok {\n" + v + " = " + x + "\nreturn nil\n}\n"
+	}
+	var s string
+	switch {
+	case f.generated:
+		s = "if bd.Kind == mongo.KindDocument {\n"
+		if strings.HasPrefix(f.typ, "*") {
+			s += "if " + v + " == nil {\n" + v + " = new(" + f.typ[1:] + ")\n}\n"
+		}
+		s += "return " + v + ".UnmarshalBSON(bd.Data)\n}\n"
+	case f.typ == "string":
+		s = fast("StringOK", "")
+	case f.typ == "bool":
+		s = fast("BoolOK", "")
+	case f.typ == "int":
+		s = fast("Int32OK", "int")
+	case f.typ == "int32":
+		s = fast("Int32OK", "")
+	case f.typ == "int64":
+		s = fast("Int32OK", "int64") + fast("Int64OK", "")
+	case f.typ == "float64":
+		s = fast("DoubleOK", "")
+	case f.typ == "time.Time":
+		s = fast("TimeOK", "")
+	case f.typ == "mongo.ObjectId":
+		s = fast("ObjectIdOK", "")
+	}
+	return s + "return bd.Decode(&" + v + ")\n"
+}
+
+// isNullable returns true if the field has type mongo.Nullable.
+func (f *field) isNullable() bool {
+	return strings.HasPrefix(f.typ, "mongo.Nullable[")
+}
+
+func writeUnmarshal(buf *bytes.Buffer, typeName string, fields []*field) {
+	sorted := append([]*field(nil), fields...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].name < sorted[j].name })
+	// Like the reflective decoder, decode the remaining elements after a
+	// conversion error and return the first error.
+	fmt.Fprintf(buf, "\n// UnmarshalBSON implements the mongo.DocumentUnmarshaler interface.\n")
+	fmt.Fprintf(buf, "func (v *%s) UnmarshalBSON(data []byte) error {\n", typeName)
+	fmt.Fprintf(buf, "var firstErr error\n")
+	fmt.Fprintf(buf, "err := mongo.Raw(data).ForEach(func(key []byte, bd mongo.BSONData) error {\n")
+	fmt.Fprintf(buf, "if err := v.unmarshalBSONElement(key, bd); err != nil && firstErr == nil {\nfirstErr = err\n}\n")
+	fmt.Fprintf(buf, "return nil\n})\n")
+	fmt.Fprintf(buf, "if err != nil {\nreturn err\n}\nreturn firstErr\n}\n")
+	fmt.Fprintf(buf, "\nfunc (v *%s) unmarshalBSONElement(key []byte, bd mongo.BSONData) error {\n", typeName)
+
+	// Like the reflective decoder, leave the field unchanged for null
+	// values unless the field is a Nullable.
+	fmt.Fprintf(buf, "if (bd.Kind == mongo.KindNull || bd.Kind == mongo.KindUndefined)")
+	for _, f := range fields {
+		if f.isNullable() {
+			fmt.Fprintf(buf, " && string(key) != %s", strconv.Quote(f.name))
+		}
+	}
+	fmt.Fprintf(buf, " {\nreturn nil\n}\n")
+	if len(sorted) > 0 {
+		fmt.Fprintf(buf, "switch string(key) {\n")
+		for _, f := range sorted {
+			fmt.Fprintf(buf, "case %s:\n%s", strconv.Quote(f.name), decodeStmts(f))
+		}
+		fmt.Fprintf(buf, "}\n")
+	}
+	fmt.Fprintf(buf, "return nil\n}\n")
+}
@@ -0,0 +1,58 @@
+// Copyright 2011 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"bytes"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"testing"
+)
+
+func TestGenerateExample(t *testing.T) {
+	actual, err := generate("example", []string{"Event", "Location"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, err := ioutil.ReadFile("example/event_bson.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(actual, expected) {
+		t.Error("example/event_bson.go is out of date, run go generate in the example directory")
+	}
+}
+
+var badStructTests = []string{
+	"struct { Embedded }",
+	"struct { A int `bson:\",inline\"` }",
+	"struct { A int `bson:\",string\"` }",
+	"struct { A int `bson:\"x\"`; B int `bson:\"x\"` }",
+}
+
+func TestBadStruct(t *testing.T) {
+	for _, src := range badStructTests {
+		fset := token.NewFileSet()
+		expr, err := parser.ParseExprFrom(fset, "", src, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := structFields(fset, "T", expr.(*ast.StructType)); err == nil {
+			t.Errorf("structFields(%s) did not return error", src)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+// Copyright 2011 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package mongo
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+// Binary subtypes.
+const (
+	BinaryGeneric     = 0x00
+	BinaryFunction    = 0x01
+	BinaryOld         = 0x02
+	BinaryUUIDOld     = 0x03
+	BinaryUUID        = 0x04
+	BinaryMD5         = 0x05
+	BinaryUserDefined = 0x80
+)
+
+// Binary represents BSON binary data with a subtype.
+//
+// Data for the BinaryOld subtype does not include the redundant inner length
+// used in the BSON encoding of that subtype.
+type Binary struct {
+	Subtype byte
+	Data    []byte
+}
+
+// UUID represents a universally unique identifier. A UUID is encoded as BSON
+// binary data with the BinaryUUID subtype. Use the UUID.Binary and
+// Binary.UUID methods to convert to and from the legacy BinaryUUIDOld
+// representations used by older drivers.
+type UUID [16]byte
+
+// NewUUID returns a new random (version 4) UUID.
+func NewUUID() (UUID, error) {
+	var u UUID
+	if _, err := rand.Read(u[:]); err != nil {
+		return u, err
+	}
+	u[6] = u[6]&0x0f | 0x40
+	u[8] = u[8]&0x3f | 0x80
+	return u, nil
+}
+
+// ParseUUID parses a UUID in the form xxxxxxxx-xxxx-xxxx-xxxx-xxxxxxxxxxxx.
+// The hyphens are optional.
+func ParseUUID(s string) (UUID, error) {
+	var u UUID
+	var h []byte
+	switch len(s) {
+	case 36:
+		if s[8] != '-' || s[13] != '-' || s[18] != '-' || s[23] != '-' {
+			return u, fmt.Errorf("mongo: invalid UUID %q", s)
+		}
+		h = []byte(s[0:8] + s[9:13] + s[14:18] + s[19:23] + s[24:])
+	case 32:
+		h = []byte(s)
+	default:
+		return u, fmt.Errorf("mongo: invalid UUID %q", s)
+	}
+	if _, err := hex.Decode(u[:], h); err != nil {
+		return u, fmt.Errorf("mongo: invalid UUID %q", s)
+	}
+	return u, nil
+}
+
+// String returns the UUID in the form xxxxxxxx-xxxx-xxxx-xxxx-xxxxxxxxxxxx.
+func (u UUID) String() string {
+	var buf [36]byte
+	hex.Encode(buf[0:8], u[0:4])
+	buf[8] = '-'
+	hex.Encode(buf[9:13], u[4:6])
+	buf[13] = '-'
+	hex.Encode(buf[14:18], u[6:8])
+	buf[18] = '-'
+	hex.Encode(buf[19:23], u[8:10])
+	buf[23] = '-'
+	hex.Encode(buf[24:], u[10:])
+	return string(buf[:])
+}
+
+// UUIDRepresentation specifies the byte order of a UUID in BSON binary data.
+type UUIDRepresentation int
+
+const (
+	// UUIDStandard is the BinaryUUID subtype with bytes in network order.
+	UUIDStandard UUIDRepresentation = iota
+
+	// UUIDJavaLegacy is the BinaryUUIDOld subtype with the bytes of each
+	// half of the UUID reversed, as used by the legacy Java driver.
+	UUIDJavaLegacy
+
+	// UUIDCSharpLegacy is the BinaryUUIDOld subtype with the first three
+	// groups of the UUID in little endian order, as used by the legacy C#
+	// driver.
+	UUIDCSharpLegacy
+
+	// UUIDPythonLegacy is the BinaryUUIDOld subtype with bytes in network
+	// order, as used by the legacy Python driver.
+	UUIDPythonLegacy
+)
+
+// swapUUID converts between network order and the byte order for
+// representation r. The conversion is its own inverse.
+func swapUUID(u UUID, r UUIDRepresentation) UUID {
+	switch r {
+	case UUIDJavaLegacy:
+		for i := 0; i < 4; i++ {
+			u[i], u[7-i] = u[7-i], u[i]
+			u[8+i], u[15-i] = u[15-i], u[8+i]
+		}
+	case UUIDCSharpLegacy:
+		u[0], u[1], u[2], u[3] = u[3], u[2], u[1], u[0]
+		u[4], u[5] = u[5], u[4]
+		u[6], u[7] = u[7], u[6]
+	}
+	return u
+}
+
+// Binary returns the BSON binary representation of u using representation r.
+func (u UUID) Binary(r UUIDRepresentation) Binary {
+	subtype := byte(BinaryUUIDOld)
+	if r == UUIDStandard {
+		subtype = BinaryUUID
+	}
+	u = swapUUID(u, r)
+	return Binary{Subtype: subtype, Data: u[:]}
+}
+
+// UUID returns the UUID in b using representation r. An error is returned if
+// the data is not 16 bytes or the subtype does not match the representation.
+func (b Binary) UUID(r UUIDRepresentation) (UUID, error) {
+	var u UUID
+	subtype := byte(BinaryUUIDOld)
+	if r == UUIDStandard {
+		subtype = BinaryUUID
+	}
+	if b.Subtype != subtype {
+		return u, fmt.Errorf("mongo: binary subtype %d is not a UUID in the requested representation", b.Subtype)
+	}
+	if len(b.Data) != len(u) {
+		return u, errors.New("mongo: binary UUID does not have 16 bytes")
+	}
+	copy(u[:], b.Data)
+	return swapUUID(u, r), nil
+}
@@ -0,0 +1,135 @@
+// Copyright 2011 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package mongo
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func TestUUIDString(t *testing.T) {
+	const s = "00112233-4455-6677-8899-aabbccddeeff"
+	u, err := ParseUUID(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.String() != s {
+		t.Errorf("String() = %q, want %q", u.String(), s)
+	}
+	if u2, err := ParseUUID("00112233445566778899AABBCCDDEEFF"); err != nil || u2 != u {
+		t.Errorf("ParseUUID(no hyphens) = %v, %v, want %v", u2, err, u)
+	}
+	for _, bad := range []string{"", "00112233-4455-6677-8899-aabbccddeef", "0011223344-55-6677-8899-aabbccddeeff", "zz112233-4455-6677-8899-aabbccddeeff"} {
+		if _, err := ParseUUID(bad); err == nil {
+			t.Errorf("ParseUUID(%q) did not return error", bad)
+		}
+	}
+}
+
+func TestNewUUID(t *testing.T) {
+	u, err := NewUUID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u[6]>>4 != 4 || u[8]>>6 != 2 {
+		t.Errorf("NewUUID() = %v, not a version 4 variant 1 UUID", u)
+	}
+}
+
+var uuidRepresentationTests = []struct {
+	r       UUIDRepresentation
+	subtype byte
+	data    string
+}{
+	{UUIDStandard, BinaryUUID, "00112233445566778899aabbccddeeff"},
+	{UUIDJavaLegacy, BinaryUUIDOld, "7766554433221100ffeeddccbbaa9988"},
+	{UUIDCSharpLegacy, BinaryUUIDOld, "33221100554477668899aabbccddeeff"},
+	{UUIDPythonLegacy, BinaryUUIDOld, "00112233445566778899aabbccddeeff"},
+}
+
+func TestUUIDRepresentation(t *testing.T) {
+	u, _ := ParseUUID("00112233-4455-6677-8899-aabbccddeeff")
+	for _, tt := range uuidRepresentationTests {
+		data, _ := hex.DecodeString(tt.data)
+		b := u.Binary(tt.r)
+		if b.Subtype != tt.subtype || !bytes.Equal(b.Data, data) {
+			t.Errorf("Binary(%d) = %d %x, want %d %s", tt.r, b.Subtype, b.Data, tt.subtype, tt.data)
+		}
+		u2, err := Binary{tt.subtype, data}.UUID(tt.r)
+		if err != nil || u2 != u {
+			t.Errorf("UUID(%d) = %v, %v, want %v", tt.r, u2, err, u)
+		}
+	}
+	if _, err := (Binary{BinaryGeneric, make([]byte, 16)}).UUID(UUIDStandard); err == nil {
+		t.Error("UUID() on generic subtype did not return error")
+	}
+	if _, err := (Binary{BinaryUUID, make([]byte, 15)}).UUID(UUIDStandard); err == nil {
+		t.Error("UUID() on short data did not return error")
+	}
+}
+
+func TestDecodeBinaryInterface(t *testing.T) {
+	u, _ := ParseUUID("00112233-4455-6677-8899-aabbccddeeff")
+	data, err := Encode(nil, D{
+		{"generic", []byte("a")},
+		{"uuid", u},
+		{"legacy", u.Binary(UUIDJavaLegacy)},
+		{"md5", Binary{BinaryMD5, []byte("b")}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m M
+	if err := Decode(data, &m); err != nil {
+		t.Fatal(err)
+	}
+	if b, ok := m["generic"].([]byte); !ok || string(b) != "a" {
+		t.Errorf("generic = %#v, want []byte", m["generic"])
+	}
+	if m["uuid"] != u {
+		t.Errorf("uuid = %#v, want %v", m["uuid"], u)
+	}
+	if b, ok := m["legacy"].(Binary); !ok || b.Subtype != BinaryUUIDOld {
+		t.Errorf("legacy = %#v, want Binary with subtype 3", m["legacy"])
+	}
+	if b, ok := m["md5"].(Binary); !ok || b.Subtype != BinaryMD5 || string(b.Data) != "b" {
+		t.Errorf("md5 = %#v, want Binary with subtype 5", m["md5"])
+	}
+
+	var st struct {
+		Generic UUID   `bson:"generic"`
+		MD5     []byte `bson:"md5"`
+	}
+	if err := Decode(data, &st); err == nil {
+		t.Error("decoding generic binary to UUID did not return error")
+	}
+	if string(st.MD5) != "b" {
+		t.Errorf("md5 = %q, want b", st.MD5)
+	}
+
+	var legacy struct {
+		Legacy UUID `bson:"legacy"`
+		UUID   UUID `bson:"uuid"`
+	}
+	err = Decode(data, &legacy)
+	if err == nil || !strings.Contains(err.Error(), "Binary.UUID") {
+		t.Errorf("decoding legacy UUID to UUID returned %v, want error", err)
+	}
+	if legacy.Legacy != (UUID{}) || legacy.UUID != u {
+		t.Errorf("legacy = %v, uuid = %v, want zero and %v", legacy.Legacy, legacy.UUID, u)
+	}
+}
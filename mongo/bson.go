@@ -15,12 +15,7 @@
 package mongo
 
 import (
-	"crypto/rand"
-	"encoding/binary"
-	"encoding/hex"
-	"encoding/json"
 	"errors"
-	"fmt"
 	"reflect"
 	"strconv"
 	"strings"
@@ -53,111 +48,6 @@ type Regexp struct {
 	Options string
 }
 
-// ObjectId represents a BSON object identifier.
-type ObjectId string
-
-// String returns the hexadecimal encoding of id. Use the function
-// NewObjectIdHex to convert the string back to an object id.
-func (id ObjectId) String() string {
-	return hex.EncodeToString([]byte(string(id)))
-}
-
-// MarshalJSON returns the JSON encoding of id.
-func (id ObjectId) MarshalJSON() ([]byte, error) {
-	return json.Marshal(id.String())
-}
-
-// UnmarshalJSON decodes id from JSON to ObjectId.
-func (id *ObjectId) UnmarshalJSON(data []byte) error {
-	if len(data) != 26 || data[0] != '"' || data[25] != '"' {
-		return fmt.Errorf("mongo: invalid ObjectId in JSON: %q", data)
-	}
-	var err error
-	*id, err = NewObjectIdHex(string(data[1:25]))
-	return err
-}
-
-func newObjectId(t time.Time, c uint64) ObjectId {
-	u := t.Unix()
-	b := [12]byte{
-		byte(u >> 24),
-		byte(u >> 16),
-		byte(u >> 8),
-		byte(u),
-		byte(c >> 56),
-		byte(c >> 48),
-		byte(c >> 40),
-		byte(c >> 32),
-		byte(c >> 24),
-		byte(c >> 16),
-		byte(c >> 8),
-		byte(c)}
-	return ObjectId(b[:])
-}
-
-// NewObjectId returns a new object id. This function uses the following format
-// for object ids:
-//
-//  [0:4]  Big endian time since epoch in seconds. This is compatible
-//         with other drivers.
-//
-//  [4:12] Incrementing counter initialized with cryptographic random number.
-//          This ensures that object ids are unique, but is simpler than
-//          the format used by other drivers.
-func NewObjectId() ObjectId {
-	return newObjectId(time.Now(), nextOidCounter())
-}
-
-// NewObjectIdHex returns an object id initialized from the hexadecimal
-// encoding of the object id.
-func NewObjectIdHex(hexString string) (ObjectId, error) {
-	p, err := hex.DecodeString(hexString)
-	if err != nil {
-		return "", err
-	}
-	if len(p) != 12 {
-		return "", errors.New("mongo: bad object id string len")
-	}
-	return ObjectId(p), nil
-}
-
-// MaxObjectIdForTime returns the maximum object id for time t in seconds from
-// the epoch.
-func MaxObjectIdForTime(t time.Time) ObjectId {
-	return newObjectId(t, 0xffffffffffffffff)
-}
-
-// MinObjectIdForTime returns the minimum object id for time t in seconds from
-// the epoch.
-func MinObjectIdForTime(t time.Time) ObjectId {
-	return newObjectId(t, 0)
-}
-
-// CreationTime extracts the time the object id was created in seconds since the epoch.
-func (id ObjectId) CreationTime() time.Time {
-	if len(id) != 12 {
-		return time.Time{}
-	}
-	return time.Unix(int64(id[0])<<24+int64(id[1])<<16+int64(id[2])<<8+int64(id[3]), 0)
-}
-
-var (
-	oidLock    sync.Mutex
-	oidCounter uint64
-)
-
-func nextOidCounter() uint64 {
-	oidLock.Lock()
-	defer oidLock.Unlock()
-	if oidCounter == 0 {
-		if err := binary.Read(rand.Reader, binary.BigEndian, &oidCounter); err != nil {
-			panic(err)
-		}
-	}
-	oidCounter += 1
-	return oidCounter
-}
-
 // BSONData represents a chunk of uninterpreted BSON data. Use this type to
 // copy raw data into or out of a BSON encoding.
 type BSONData struct {
@@ -168,7 +58,7 @@ type BSONData struct {
 // Deocde decodes bd to v. See the Decode function for more information about
 // BSON decoding.
 func (bd BSONData) Decode(v interface{}) error {
-	return decodeInternal(bd.Kind, bd.Data, v)
+	return decodeInternal(bd.Kind, bd.Data, v, nil)
 }
 
 // Symbol represents a BSON symbol.
@@ -177,6 +67,15 @@ type Symbol string
 // Code represents Javascript code in BSON.
 type Code string
 
+// Undefined represents the deprecated BSON undefined value.
+type Undefined struct{}
+
+// DBPointer represents the deprecated BSON DBPointer type.
+type DBPointer struct {
+	Namespace string
+	Id        ObjectId
+}
+
 type DocItem struct {
 	Key   string
 	Value interface{}
@@ -211,46 +110,54 @@ const (
 	MinValue MinMax = -1
 )
 
+// BSON element kinds. The kinds are used in BSONData and by the Marshaler and
+// Unmarshaler interfaces.
 const (
-	kindFloat         = 0x1
-	kindString        = 0x2
-	kindDocument      = 0x3
-	kindArray         = 0x4
-	kindBinary        = 0x5
-	kindObjectId      = 0x7
-	kindBool          = 0x8
-	kindDateTime      = 0x9
-	kindNull          = 0xA
-	kindRegexp        = 0xB
-	kindCode          = 0xD
-	kindSymbol        = 0xE
-	kindCodeWithScope = 0xF
-	kindInt32         = 0x10
-	kindTimestamp     = 0x11
-	kindInt64         = 0x12
-	kindMinValue      = 0xff
-	kindMaxValue      = 0x7f
+	KindFloat         = 0x1
+	KindString        = 0x2
+	KindDocument      = 0x3
+	KindArray         = 0x4
+	KindBinary        = 0x5
+	KindUndefined     = 0x6
+	KindObjectId      = 0x7
+	KindBool          = 0x8
+	KindDateTime      = 0x9
+	KindNull          = 0xA
+	KindRegexp        = 0xB
+	KindDBPointer     = 0xC
+	KindCode          = 0xD
+	KindSymbol        = 0xE
+	KindCodeWithScope = 0xF
+	KindInt32         = 0x10
+	KindTimestamp     = 0x11
+	KindInt64         = 0x12
+	KindDecimal128    = 0x13
+	KindMinValue      = 0xff
+	KindMaxValue      = 0x7f
 )
 
 var kindNames = map[int]string{
-	kindFloat:         "float",
-	kindString:        "string",
-	kindDocument:      "document",
-	kindArray:         "array",
-	kindBinary:        "binary",
-	kindObjectId:      "objectId",
-	kindBool:          "bool",
-	kindDateTime:      "dateTime",
-	kindNull:          "null",
-	kindRegexp:        "regexp",
-	kindCode:          "code",
-	kindSymbol:        "symbol",
-	kindCodeWithScope: "codeWithScope",
-	kindInt32:         "int32",
-	kindTimestamp:     "timestamp",
-	kindInt64:         "int64",
-	kindMinValue:      "minValue",
-	kindMaxValue:      "maxValue",
+	KindFloat:         "float",
+	KindString:        "string",
+	KindDocument:      "document",
+	KindArray:         "array",
+	KindBinary:        "binary",
+	KindUndefined:     "undefined",
+	KindObjectId:      "objectId",
+	KindBool:          "bool",
+	KindDateTime:      "dateTime",
+	KindNull:          "null",
+	KindRegexp:        "regexp",
+	KindDBPointer:     "dbPointer",
+	KindCode:          "code",
+	KindSymbol:        "symbol",
+	KindCodeWithScope: "codeWithScope",
+	KindInt32:         "int32",
+	KindTimestamp:     "timestamp",
+	KindInt64:         "int64",
+	KindDecimal128:    "decimal128",
+	KindMinValue:      "minValue",
+	KindMaxValue:      "maxValue",
 }
 
 func kindName(kind int) string {
@@ -265,37 +172,67 @@ type fieldSpec struct {
 	name      string
 	index     []int
 	omitEmpty bool
+	minSize   bool // encode int64 as Integer32 when the value fits
+	truncate  bool // allow lossy conversion from Double to integer
+	asString  bool // encode number as String
+	nullable  bool // field type is Nullable
+
+	// Encode time.Duration as an integer count of this unit. Zero if the
+	// duration is encoded in nanoseconds.
+	durationUnit time.Duration
 }
 
 type structSpec struct {
-	m      map[string]*fieldSpec
-	l      []*fieldSpec
-	fields D
+	m         map[string]*fieldSpec
+	l         []*fieldSpec
+	fields    D
+	inlineMap []int // index of map for elements not matching a field
 }
 
 func (ss *structSpec) fieldSpec(name []byte) *fieldSpec {
 	return ss.m[string(name)]
 }
 
-func compileStructSpec(t reflect.Type, depth map[string]int, index []int, ss *structSpec) {
+// compileStructSpec adds the fields of struct type t to ss. The visiting map
+// holds the embedded struct types on the path from the top-level type to t and
+// is used to break cycles through embedded pointers.
+func compileStructSpec(t reflect.Type, depth map[string]int, index []int, ss *structSpec, visiting map[reflect.Type]bool) {
+	visiting[t] = true
+	defer delete(visiting, t)
 	for i := 0; i < t.NumField(); i++ {
 		f := t.Field(i)
 		switch {
-		case f.PkgPath != "":
-			// Ignore unexported fields.
 		case f.Anonymous:
-			// TODO: Handle pointers. Requires change to decoder and
-			// protection against infinite recursion.
-			if f.Type.Kind() == reflect.Struct {
-				compileStructSpec(f.Type, depth, append(index, i), ss)
+			// Embedded structs are encoded in-line. Fields of embedded
+			// unexported struct values are promoted, but embedded unexported
+			// struct pointers are ignored because the decoder cannot allocate
+			// them.
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				if f.PkgPath != "" {
+					continue
+				}
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct && !visiting[ft] {
+				compileStructSpec(ft, depth, append(index, i), ss, visiting)
 			}
+		case f.PkgPath != "":
+			// Ignore unexported fields.
 		default:
-			fs := &fieldSpec{name: f.Name}
+			fs := &fieldSpec{name: f.Name, nullable: f.Type.Implements(typeNullable)}
 			tag := f.Tag.Get("bson")
 			if strings.Contains(tag, "/c") {
 				panic("use ,omitempty instead of /c in bson field tag")
 			}
 			p := strings.Split(tag, ",")
+			inline := false
+			// The minsize and truncate flags on a Nullable field apply to
+			// the field's value.
+			vt := f.Type
+			if fs.nullable && vt.Kind() == reflect.Struct {
+				vt = vt.Field(nullableValue).Type
+			}
 			if len(p) > 0 {
 				if p[0] == "-" {
 					continue
@@ -307,11 +244,69 @@ func compileStructSpec(t reflect.Type, depth map[string]int, index []int, ss *st
 					switch s {
 					case "omitempty":
 						fs.omitEmpty = true
+					case "minsize":
+						switch vt.Kind() {
+						case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint64:
+						default:
+							panic(errors.New("bson: minsize flag not allowed on field " + f.Name + " of type " + t.Name()))
+						}
+						fs.minSize = true
+					case "truncate":
+						ft := vt
+						for ft.Kind() == reflect.Ptr {
+							ft = ft.Elem()
+						}
+						if !isIntegerType(ft) && ft != typeTime {
+							panic(errors.New("bson: truncate flag not allowed on field " + f.Name + " of type " + t.Name()))
+						}
+						fs.truncate = true
+					case "string":
+						switch f.Type.Kind() {
+						case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+							reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+							reflect.Float32, reflect.Float64:
+						default:
+							panic(errors.New("bson: string flag not allowed on field " + f.Name + " of type " + t.Name()))
+						}
+						fs.asString = true
+					case "millis", "seconds":
+						if f.Type != typeDuration {
+							panic(errors.New("bson: " + s + " flag not allowed on field " + f.Name + " of type " + t.Name()))
+						}
+						fs.durationUnit = time.Millisecond
+						if s == "seconds" {
+							fs.durationUnit = time.Second
+						}
+					case "inline":
+						inline = true
 					default:
 						panic(errors.New("bson: unknown field flag " + s + " for type " + t.Name()))
 					}
 				}
 			}
+			if fs.asString && fs.durationUnit != 0 {
+				panic(errors.New("bson: conflicting flags on field " + f.Name + " of type " + t.Name()))
+			}
+			if inline {
+				switch {
+				case f.Type.Kind() == reflect.Struct:
+					compileStructSpec(f.Type, depth, append(index, i), ss, visiting)
+				case f.Type.Kind() == reflect.Ptr && f.Type.Elem().Kind() == reflect.Struct:
+					if !visiting[f.Type.Elem()] {
+						compileStructSpec(f.Type.Elem(), depth, append(index, i), ss, visiting)
+					}
+				case f.Type.Kind() == reflect.Map && isEncodableMapKey(f.Type.Key()) && isDecodableMapKey(f.Type.Key()):
+					if ss.inlineMap != nil {
+						panic(errors.New("bson: multiple inline maps in type " + t.Name()))
+					}
+					ss.inlineMap = make([]int, len(index)+1)
+					copy(ss.inlineMap, index)
+					ss.inlineMap[len(index)] = i
+				default:
+					panic(errors.New("bson: inline flag not allowed on field " + f.Name + " of type " + t.Name()))
+				}
+				continue
+			}
 			d, found := depth[fs.name]
 			if !found {
 				d = 1 << 30
@@ -363,7 +358,7 @@ func structSpecForType(t reflect.Type) *structSpec {
 	}
 
 	ss = &structSpec{m: make(map[string]*fieldSpec)}
-	compileStructSpec(t, make(map[string]int), nil, ss)
+	compileStructSpec(t, make(map[string]int), nil, ss, make(map[reflect.Type]bool))
 
 	hasId := false
 	for _, fs := range ss.l {
@@ -385,7 +380,27 @@ func structSpecForType(t reflect.Type) *structSpec {
 // StructFields returns a MongoDB field specification for the given struct
 // type.
 func StructFields(t reflect.Type) interface{} {
-	return structSpecForType(t).fields
+	ss := structSpecForType(t)
+	if ss.inlineMap != nil {
+		// The inline map holds elements that are not known in advance.
+		return nil
+	}
+	return ss.fields
+}
+
+// fieldByIndexAlloc returns the nested field of v with the given index,
+// allocating nil struct pointers along the path.
+func fieldByIndexAlloc(v reflect.Value, index []int) reflect.Value {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v
 }
 
 type aborted struct{ err error }
@@ -409,3 +424,8 @@ func msFromTime(t time.Time) int64 {
 func timeFromMS(ms int64) time.Time {
 	return time.Unix(ms/1e3, (ms%1e3)*1e6).In(time.UTC)
 }
+
+var (
+	typeDuration = reflect.TypeOf(time.Duration(0))
+	typeTime     = reflect.TypeOf(time.Time{})
+)
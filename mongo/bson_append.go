@@ -0,0 +1,138 @@
+// Copyright 2011 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package mongo
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"time"
+)
+
+// The Append functions write BSON without reflection. The functions are used
+// by code generated with the bsongen command and can be used directly to
+// build documents in performance sensitive code.
+
+// AppendDocumentStart appends the length placeholder for a document to buf.
+// The returned offset is passed to AppendDocumentEnd.
+func AppendDocumentStart(buf []byte) ([]byte, int) {
+	return append(buf, 0, 0, 0, 0), len(buf)
+}
+
+// AppendDocumentEnd appends the document terminator to buf and sets the length
+// of the document that starts at offset.
+func AppendDocumentEnd(buf []byte, offset int) []byte {
+	buf = append(buf, 0)
+	wire.PutUint32(buf[offset:], uint32(len(buf)-offset))
+	return buf
+}
+
+// AppendElementName appends the kind and name of an element to buf. The caller
+// appends the value.
+func AppendElementName(buf []byte, kind int, name string) []byte {
+	buf = append(buf, byte(kind))
+	buf = append(buf, name...)
+	return append(buf, 0)
+}
+
+// AppendStringElement appends a String element to buf.
+func AppendStringElement(buf []byte, name string, s string) []byte {
+	buf = AppendElementName(buf, KindString, name)
+	buf = wire.AppendUint32(buf, uint32(len(s)+1))
+	buf = append(buf, s...)
+	return append(buf, 0)
+}
+
+// AppendBoolElement appends a Boolean element to buf.
+func AppendBoolElement(buf []byte, name string, b bool) []byte {
+	buf = AppendElementName(buf, KindBool, name)
+	if b {
+		return append(buf, 1)
+	}
+	return append(buf, 0)
+}
+
+// AppendInt32Element appends an Integer32 element to buf.
+func AppendInt32Element(buf []byte, name string, i int32) []byte {
+	buf = AppendElementName(buf, KindInt32, name)
+	return wire.AppendUint32(buf, uint32(i))
+}
+
+// AppendInt64Element appends an Integer64 element to buf.
+func AppendInt64Element(buf []byte, name string, i int64) []byte {
+	buf = AppendElementName(buf, KindInt64, name)
+	return wire.AppendUint64(buf, uint64(i))
+}
+
+// AppendIntElement appends an Integer32 element to buf if i fits in an
+// Integer32. Otherwise, an Integer64 element is appended.
+func AppendIntElement(buf []byte, name string, i int64) []byte {
+	if i >= math.MinInt32 && i <= math.MaxInt32 {
+		return AppendInt32Element(buf, name, int32(i))
+	}
+	return AppendInt64Element(buf, name, i)
+}
+
+// AppendDoubleElement appends a Double element to buf.
+func AppendDoubleElement(buf []byte, name string, f float64) []byte {
+	buf = AppendElementName(buf, KindFloat, name)
+	return wire.AppendUint64(buf, math.Float64bits(f))
+}
+
+// AppendDateTimeElement appends a UTC Datetime element to buf.
+func AppendDateTimeElement(buf []byte, name string, t time.Time) []byte {
+	buf = AppendElementName(buf, KindDateTime, name)
+	return wire.AppendUint64(buf, uint64(msFromTime(t)))
+}
+
+// AppendBinaryElement appends a Binary element to buf.
+func AppendBinaryElement(buf []byte, name string, subtype byte, data []byte) []byte {
+	buf = AppendElementName(buf, KindBinary, name)
+	if subtype == BinaryOld {
+		buf = wire.AppendUint32(buf, uint32(len(data)+4))
+		buf = append(buf, subtype)
+		buf = wire.AppendUint32(buf, uint32(len(data)))
+	} else {
+		buf = wire.AppendUint32(buf, uint32(len(data)))
+		buf = append(buf, subtype)
+	}
+	return append(buf, data...)
+}
+
+// AppendObjectIdElement appends an ObjectId element to buf.
+func AppendObjectIdElement(buf []byte, name string, oid ObjectId) ([]byte, error) {
+	if len(oid) != 12 {
+		return buf, errors.New("bson: object id length != 12")
+	}
+	buf = AppendElementName(buf, KindObjectId, name)
+	return append(buf, oid...), nil
+}
+
+// AppendElement appends an element with the given name and value to buf
+// using the encoding rules of the Encode function. If omitEmpty is true, then
+// the element is handled as if the value is a struct field with the omitempty
+// option.
+func AppendElement(buf []byte, name string, value interface{}, omitEmpty bool) (result []byte, err error) {
+	defer handleAbort(&err)
+	e := encodeStatePool.Get().(*encodeState)
+	defer e.release()
+	e.buffer = buf
+	fs := defaultFieldSpec
+	if omitEmpty {
+		fs = &fieldSpec{name: name, omitEmpty: true}
+	}
+	e.encodeValue(name, fs, reflect.ValueOf(value))
+	return e.buffer, nil
+}
@@ -0,0 +1,81 @@
+// Copyright 2011 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package mongo
+
+import (
+	"bytes"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestAppend(t *testing.T) {
+	now := time.Unix(1300000000, 0)
+	oid := ObjectId("\x01\x02\x03\x04\x05\x06\x07\x08\x09\x0a\x0b\x0c")
+	expected, _ := Encode(nil, D{
+		{"s", "hello"},
+		{"b", true},
+		{"i32", int32(-1)},
+		{"i64", int64(1)},
+		{"small", 2},
+		{"big", math.MaxInt32 + 1},
+		{"f", 1.5},
+		{"t", now},
+		{"bin", []byte("data")},
+		{"oid", oid},
+		{"a", []int{1, 2}},
+	})
+
+	buf, offset := AppendDocumentStart(nil)
+	buf = AppendStringElement(buf, "s", "hello")
+	buf = AppendBoolElement(buf, "b", true)
+	buf = AppendInt32Element(buf, "i32", -1)
+	buf = AppendInt64Element(buf, "i64", 1)
+	buf = AppendIntElement(buf, "small", 2)
+	buf = AppendIntElement(buf, "big", math.MaxInt32+1)
+	buf = AppendDoubleElement(buf, "f", 1.5)
+	buf = AppendDateTimeElement(buf, "t", now)
+	buf = AppendBinaryElement(buf, "bin", BinaryGeneric, []byte("data"))
+	buf, err := AppendObjectIdElement(buf, "oid", oid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf, err = AppendElement(buf, "a", []int{1, 2}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf, err = AppendElement(buf, "empty", "", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf = AppendDocumentEnd(buf, offset)
+
+	if !bytes.Equal(buf, expected) {
+		t.Errorf("append\n got %q\nwant %q", buf, expected)
+	}
+
+	var keys []string
+	err = Raw(buf).ForEach(func(key []byte, value BSONData) error {
+		keys = append(keys, string(key))
+		return nil
+	})
+	if err != nil || len(keys) != 11 || keys[10] != "a" {
+		t.Errorf("ForEach() visited %v, %v", keys, err)
+	}
+
+	if _, err := AppendElement(nil, "x", make(chan int), false); err == nil {
+		t.Error("AppendElement(chan) did not return error")
+	}
+}
@@ -15,9 +15,12 @@
 package mongo
 
 import (
+	"encoding"
 	"errors"
 	"math"
 	"reflect"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -44,6 +47,44 @@ func (e *DecodeTypeError) Error() string {
 	return "bson: could not decode " + kindName(e.kind)
 }
 
+// DecodeFieldError describes an unknown field or a type mismatch found by a
+// strict decode.
+type DecodeFieldError struct {
+	// Dotted path to the element. Array elements are identified by index.
+	Path string
+
+	// Kind of the BSON element.
+	Kind int
+
+	// Type of the target value or nil if the element does not match a struct
+	// field.
+	Type reflect.Type
+}
+
+func (e *DecodeFieldError) Error() string {
+	if e.Type == nil {
+		return "bson: unknown field " + e.Path
+	}
+	return "bson: could not decode " + kindName(e.Kind) + " at " + e.Path + " to " + e.Type.String()
+}
+
+// StrictDecodeError is returned by a strict decode when the document has
+// unknown fields or values that cannot be converted to the target type.
+type StrictDecodeError struct {
+	Errors []*DecodeFieldError
+}
+
+func (e *StrictDecodeError) Error() string {
+	s := "bson: strict decode failed: "
+	for i, err := range e.Errors {
+		if i > 0 {
+			s += "; "
+		}
+		s += strings.TrimPrefix(err.Error(), "bson: ")
+	}
+	return s
+}
+
 // Deocde decodes BSON data to value v.
 //
 // Decode traverses the value v recursively. Decode uses the inverse of the
@@ -53,30 +94,106 @@ func (e *DecodeTypeError) Error() string {
 //      BSON                -> Go
 //      Integer32           -> signed and unsigned integers, floats, bool
 //      Integer64           -> signed and unsigned integers, floats, bool
-//      Array               -> []interface{}, other slice types
-//      Binary              -> []byte
+//      Array               -> []interface{}, mongo.A, other slice types
+//      Binary              -> []byte, mongo.Binary, mongo.UUID
 //      Boolean             -> bool
+//      Code                -> mongo.Code, string, mongo.CodeWithScope
+//      CodeWithScope       -> mongo.CodeWithScope
 //      Datetime            -> time.Time, int64
-//      Document            -> map[string]interface{}, struct types
+//      DBPointer           -> mongo.DBPointer
+//      Decimal128          -> mongo.Decimal128
+//      Document            -> map[string]interface{}, mongo.D, struct types, mongo.Raw
 //      Double              -> signed and unsigned integers, floats, bool
 //      MinValue, MaxValue  -> mongo.MinMax
 //      ObjectID            -> mongo.ObjectId
+//      Regexp              -> mongo.Regexp
 //      Symbol              -> mongo.Symbol, string
 //      Timestamp           -> mongo.Timestamp, int64
+//      Undefined           -> mongo.Undefined
 //      string              -> string
 //
+// If a pointer to the target type implements the Unmarshaler interface, then
+// the UnmarshalBSONValue method is called with the BSON value. If a pointer to
+// the target type implements the DocumentUnmarshaler interface, then the
+// UnmarshalBSON method is called with the BSON document. Decode options are
+// not passed to these methods.
+//
 // If a number overflows the target type or the BSON value cannot be converted
 // to the target type, then the decoding completes the best it can and an error
 // is returned.
 //
+// The fractional part of a Double decoded to an integer is discarded. If the
+// StrictPrecision decode option is set, then such a conversion is an error
+// unless the struct field has the truncate flag.
+//
+// Datetime values decode to times in UTC unless the Location decode option is
+// set.
+//
+// Null and undefined elements in a document are skipped unless the target is
+// a Nullable or the PreserveNulls decode option is set.
+//
+// Documents decode to maps with the key types supported by Encode. Element
+// names are parsed as decimal numbers for integer keys and passed to
+// UnmarshalText for keys where a pointer to the key type implements the
+// encoding.TextUnmarshaler interface.
+//
 // To decode a BSON value into a nil interface value, the first type listed in
-// the right hand column of the table above is used.
+// the right hand column of the table above is used. The exception is binary
+// data: the UUID subtype decodes to mongo.UUID and subtypes other than generic
+// and old binary decode to mongo.Binary.
+//
+// Only the standard UUID subtype decodes to mongo.UUID. Decode legacy UUIDs
+// (subtype 3) to mongo.Binary and convert them with Binary.UUID.
+//
+// Values in a mongo.D or mongo.A target decode as if the Ordered decode option
+// is set: nested documents decode to mongo.D and nested arrays decode to
+// mongo.A.
 func Decode(data []byte, v interface{}) (err error) {
-	return decodeInternal(kindDocument, data, v)
+	return decodeInternal(KindDocument, data, v, nil)
+}
+
+// DecodeOptions specifies options for DecodeWithOptions.
+type DecodeOptions struct {
+	// Registry of additional decoders. If nil, then only the built-in
+	// decodings are used.
+	Registry *Registry
+
+	// If Ordered is true, then documents decode to D and arrays decode to A
+	// when the target is an empty interface. Null values decode to
+	// BSONData{Kind: KindNull} so that the decoded value encodes to the
+	// original document.
+	Ordered bool
+
+	// If Strict is true, then elements that do not match a struct field and
+	// values that cannot be converted to the target type are reported in a
+	// *StrictDecodeError. Errors other than these are returned as is.
+	Strict bool
+
+	// If PreserveNulls is true, then null elements are decoded instead of
+	// skipped. A null element is stored in a map as the zero value of the
+	// map's element type and sets pointer, interface and other struct fields
+	// to the zero value. Nullable fields record null elements with or
+	// without this option.
+	PreserveNulls bool
+
+	// Location for decoded times. If nil, then times are decoded in UTC.
+	Location *time.Location
+
+	// If StrictPrecision is true, then decoding a Double with a fractional
+	// part to an integer, or to a time.Duration with the millis or seconds
+	// flag when the value is not a whole number of nanoseconds, is an error
+	// unless the struct field has the truncate flag.
+	StrictPrecision bool
+}
+
+// DecodeWithOptions decodes BSON data to value v using the given options. See
+// the Decode function for more information about BSON decoding.
+func DecodeWithOptions(data []byte, v interface{}, options *DecodeOptions) error {
+	return decodeInternal(KindDocument, data, v, options)
 }
 
 // decodeInternal decodes BSON data with given kind to v.
-func decodeInternal(kind int, data []byte, v interface{}) (err error) {
+func decodeInternal(kind int, data []byte, v interface{}, options *DecodeOptions) (err error) {
 	defer handleAbort(&err)
 	value, ok := v.(reflect.Value)
 	if !ok {
@@ -97,7 +214,18 @@ func decodeInternal(kind int, data []byte, v interface{}) (err error) {
 	}
 
 	d := decodeState{data: data}
+	if options != nil {
+		d.registry = options.Registry
+		d.ordered = options.Ordered
+		d.strict = options.Strict
+		d.preserveNulls = options.PreserveNulls
+		d.location = options.Location
+		d.strictPrecision = options.StrictPrecision
+	}
 	d.decodeValue(kind, value)
+	if d.savedError == nil && len(d.fieldErrors) > 0 {
+		return &StrictDecodeError{d.fieldErrors}
+	}
 	return d.savedError
 }
 
@@ -106,11 +234,33 @@ type decodeState struct {
 	data       []byte
 	offset     int // read offset in data
 	savedError error
+	registry   *Registry
+	ordered    bool // decode documents to D and arrays to A
+	truncate   bool // current integer field has the truncate flag
+
+	// Report lossy conversion from Double to integer or duration as an
+	// error.
+	strictPrecision bool
+
+	// Set null and undefined elements to the zero value instead of skipping
+	// them.
+	preserveNulls bool
+
+	location *time.Location // location for decoded times; nil for UTC
+
+	// Strict mode state.
+	strict      bool
+	path        []string
+	fieldErrors []*DecodeFieldError
 }
 
 // saveError saves the first err it is called with, for reporting at the end of
-// Decode.
+// Decode. In strict mode, all conversion errors are saved.
 func (d *decodeState) saveError(err error) {
+	if e, ok := err.(*DecodeConvertError); ok && d.strict {
+		d.fieldErrors = append(d.fieldErrors, &DecodeFieldError{strings.Join(d.path, "."), e.kind, e.t})
+		return
+	}
 	if d.savedError == nil {
 		d.savedError = err
 	}
@@ -119,8 +269,19 @@ func (d *decodeState) saveError(err error) {
 // saveErrorAndSkip skips the value and saves a conversion error.
 func (d *decodeState) saveErrorAndSkip(kind int, t reflect.Type) {
 	d.skipValue(kind)
-	if d.savedError == nil {
-		d.savedError = &DecodeConvertError{kind, t}
+	d.saveError(&DecodeConvertError{kind, t})
+}
+
+// pushPath adds an element name to the path reported in strict mode errors.
+func (d *decodeState) pushPath(name []byte) {
+	if d.strict {
+		d.path = append(d.path, string(name))
+	}
+}
+
+func (d *decodeState) popPath() {
+	if d.strict {
+		d.path = d.path[:len(d.path)-1]
 	}
 }
 
@@ -182,10 +343,59 @@ func (d *decodeState) scanString() string {
 	return s
 }
 
+func (d *decodeState) scanCString() string {
+	for i, b := range d.data[d.offset:] {
+		if b == 0 {
+			s := string(d.data[d.offset : d.offset+i])
+			d.offset += i + 1
+			return s
+		}
+	}
+	abort(ErrEOD)
+	panic("unreachable")
+}
+
+// skipCString advances past a C string without allocating.
+func (d *decodeState) skipCString() {
+	for i, b := range d.data[d.offset:] {
+		if b == 0 {
+			d.offset += i + 1
+			return
+		}
+	}
+	abort(ErrEOD)
+}
+
+func (d *decodeState) scanRegexp() Regexp {
+	pattern := d.scanCString()
+	return Regexp{Pattern: pattern, Options: d.scanCString()}
+}
+
+func (d *decodeState) scanDBPointer() DBPointer {
+	ns := d.scanString()
+	return DBPointer{Namespace: ns, Id: ObjectId(string(d.scanSlice(12)))}
+}
+
+func (d *decodeState) scanCodeWithScope() CodeWithScope {
+	offset := d.beginDoc()
+	c := CodeWithScope{Code: d.scanString()}
+	ordered := d.ordered
+	d.ordered = false
+	c.Scope, _ = d.decodeValueInterface(KindDocument).(map[string]interface{})
+	d.ordered = ordered
+	d.endDoc(offset)
+	return c
+}
+
 func (d *decodeState) scanBinary() ([]byte, int) {
 	n := int(wire.Uint32(d.scanSlice(4)))
 	subtype := int(d.scanByte())
-	return d.scanSlice(n), subtype
+	p := d.scanSlice(n)
+	if subtype == BinaryOld && len(p) >= 4 && int(wire.Uint32(p)) == len(p)-4 {
+		// Strip redundant inner length from the old binary subtype.
+		p = p[4:]
+	}
+	return p, subtype
 }
 
 func (d *decodeState) scanBool() bool {
@@ -204,10 +414,38 @@ func (d *decodeState) scanInt64() int64 {
 	return int64(wire.Uint64(d.scanSlice(8)))
 }
 
+// scanTime scans a UTC datetime and returns the time in the location set by
+// the decode options.
+func (d *decodeState) scanTime() time.Time {
+	t := timeFromMS(d.scanInt64())
+	if d.location != nil {
+		t = t.In(d.location)
+	}
+	return t
+}
+
+func (d *decodeState) scanDecimal128() Decimal128 {
+	p := d.scanSlice(16)
+	return Decimal128{h: wire.Uint64(p[8:]), l: wire.Uint64(p[:8])}
+}
+
 func (d *decodeState) decodeValue(kind int, v reflect.Value) {
+	if d.preserveNulls && (kind == KindNull || kind == KindUndefined) && d.decodeNull(v) {
+		return
+	}
 	v = d.indirect(v)
 	t := v.Type()
+	if d.registry != nil && v.CanAddr() {
+		if decoder := d.registry.decoder(t); decoder != nil {
+			decoder(d, kind, v)
+			return
+		}
+	}
 	decoder, ok := typeDecoder[t]
+	if !ok && v.CanAddr() {
+		decoder = marshalerDecoder(t)
+		ok = decoder != nil
+	}
 	if !ok {
 		decoder, ok = kindDecoder[t.Kind()]
 		if !ok {
@@ -218,6 +456,22 @@ func (d *decodeState) decodeValue(kind int, v reflect.Value) {
 	decoder(d, kind, v)
 }
 
+// decodeNull sets v to the zero value for a null element. The function returns
+// false if v has a decoder that handles null elements. Document unmarshalers
+// only handle documents, so values of those types are set to zero like any
+// other struct.
+func (d *decodeState) decodeNull(v reflect.Value) bool {
+	t := v.Type()
+	if t == typeBSONData ||
+		t.Implements(typeNullable) ||
+		reflect.PtrTo(t).Implements(typeUnmarshaler) ||
+		(d.registry != nil && d.registry.decoder(t) != nil) {
+		return false
+	}
+	v.Set(reflect.Zero(t))
+	return true
+}
+
 // indirect walks down v allocating pointers as needed, until it gets to a
 // non-pointer.
 func (d *decodeState) indirect(v reflect.Value) reflect.Value {
@@ -243,11 +497,11 @@ func decodeFloat(d *decodeState, kind int, v reflect.Value) {
 	default:
 		d.saveErrorAndSkip(kind, v.Type())
 		return
-	case kindFloat:
+	case KindFloat:
 		f = d.scanFloat()
-	case kindInt64:
+	case KindInt64:
 		f = float64(d.scanInt64())
-	case kindInt32:
+	case KindInt32:
 		f = float64(d.scanInt32())
 	}
 	if v.OverflowFloat(f) {
@@ -263,12 +517,17 @@ func decodeInt(d *decodeState, kind int, v reflect.Value) {
 	default:
 		d.saveErrorAndSkip(kind, v.Type())
 		return
-	case kindInt64, kindTimestamp, kindDateTime:
+	case KindInt64, KindTimestamp, KindDateTime:
 		n = d.scanInt64()
-	case kindInt32:
+	case KindInt32:
 		n = int64(d.scanInt32())
-	case kindFloat:
-		n = int64(d.scanFloat())
+	case KindFloat:
+		f := d.scanFloat()
+		n = int64(f)
+		if float64(n) != f && d.strictPrecision && !d.truncate {
+			d.saveError(&DecodeConvertError{kind, v.Type()})
+			return
+		}
 	}
 	if v.OverflowInt(n) {
 		d.saveError(&DecodeConvertError{kind, v.Type()})
@@ -277,18 +536,37 @@ func decodeInt(d *decodeState, kind int, v reflect.Value) {
 	v.SetInt(n)
 }
 
+// isIntegerType returns true if t is an integer type or a pointer to an
+// integer type.
+func isIntegerType(t reflect.Type) bool {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+	return false
+}
+
 func decodeUint(d *decodeState, kind int, v reflect.Value) {
 	var n uint64
 	switch kind {
 	default:
 		d.saveErrorAndSkip(kind, v.Type())
 		return
-	case kindInt64, kindTimestamp, kindDateTime:
+	case KindInt64, KindTimestamp, KindDateTime:
 		n = uint64(d.scanInt64())
-	case kindInt32:
+	case KindInt32:
 		n = uint64(d.scanInt32())
-	case kindFloat:
-		n = uint64(d.scanFloat())
+	case KindFloat:
+		f := d.scanFloat()
+		n = uint64(f)
+		if float64(n) != f && d.strictPrecision && !d.truncate {
+			d.saveError(&DecodeConvertError{kind, v.Type()})
+			return
+		}
 	}
 	if v.OverflowUint(n) {
 		d.saveError(&DecodeConvertError{kind, v.Type()})
@@ -302,8 +580,8 @@ func decodeTimestamp(d *decodeState, kind int, v reflect.Value) {
 	default:
 		d.saveErrorAndSkip(kind, v.Type())
 		return
-	case kindInt64, kindTimestamp:
-		decodeInt(d, kindInt64, v)
+	case KindInt64, KindTimestamp:
+		decodeInt(d, KindInt64, v)
 	}
 }
 
@@ -312,8 +590,18 @@ func decodeTime(d *decodeState, kind int, v reflect.Value) {
 	default:
 		d.saveErrorAndSkip(kind, v.Type())
 		return
-	case kindDateTime:
-		v.Set(reflect.ValueOf(timeFromMS(d.scanInt64())))
+	case KindDateTime:
+		v.Set(reflect.ValueOf(d.scanTime()))
+	}
+}
+
+func decodeDecimal128(d *decodeState, kind int, v reflect.Value) {
+	switch kind {
+	default:
+		d.saveErrorAndSkip(kind, v.Type())
+		return
+	case KindDecimal128:
+		v.Set(reflect.ValueOf(d.scanDecimal128()))
 	}
 }
 
@@ -323,7 +611,7 @@ func decodeString(d *decodeState, kind int, v reflect.Value) {
 	default:
 		d.saveErrorAndSkip(kind, v.Type())
 		return
-	case kindString, kindSymbol, kindCode:
+	case KindString, KindSymbol, KindCode:
 		s = d.scanString()
 	}
 	v.SetString(s)
@@ -335,12 +623,48 @@ func decodeObjectId(d *decodeState, kind int, v reflect.Value) {
 	default:
 		d.saveErrorAndSkip(kind, v.Type())
 		return
-	case kindObjectId:
+	case KindObjectId:
 		p = d.scanSlice(12)
 	}
 	v.SetString(string(p))
 }
 
+func decodeRegexp(d *decodeState, kind int, v reflect.Value) {
+	if kind != KindRegexp {
+		d.saveErrorAndSkip(kind, v.Type())
+		return
+	}
+	v.Set(reflect.ValueOf(d.scanRegexp()))
+}
+
+func decodeCodeWithScope(d *decodeState, kind int, v reflect.Value) {
+	var c CodeWithScope
+	switch kind {
+	default:
+		d.saveErrorAndSkip(kind, v.Type())
+		return
+	case KindCode:
+		c.Code = d.scanString()
+	case KindCodeWithScope:
+		c = d.scanCodeWithScope()
+	}
+	v.Set(reflect.ValueOf(c))
+}
+
+func decodeDBPointer(d *decodeState, kind int, v reflect.Value) {
+	if kind != KindDBPointer {
+		d.saveErrorAndSkip(kind, v.Type())
+		return
+	}
+	v.Set(reflect.ValueOf(d.scanDBPointer()))
+}
+
+func decodeUndefined(d *decodeState, kind int, v reflect.Value) {
+	if kind != KindUndefined {
+		d.saveErrorAndSkip(kind, v.Type())
+	}
+}
+
 func decodeBSONData(d *decodeState, kind int, v reflect.Value) {
 	start := d.offset
 	d.skipValue(kind)
@@ -355,7 +679,7 @@ func decodeByteSlice(d *decodeState, kind int, v reflect.Value) {
 	default:
 		d.saveErrorAndSkip(kind, v.Type())
 		return
-	case kindBinary:
+	case KindBinary:
 		p, _ = d.scanBinary()
 	}
 	if v.IsNil() || v.Cap() < len(p) {
@@ -366,19 +690,51 @@ func decodeByteSlice(d *decodeState, kind int, v reflect.Value) {
 	reflect.Copy(v, reflect.ValueOf(p))
 }
 
+func decodeBinary(d *decodeState, kind int, v reflect.Value) {
+	if kind != KindBinary {
+		d.saveErrorAndSkip(kind, v.Type())
+		return
+	}
+	p, subtype := d.scanBinary()
+	b := Binary{Subtype: byte(subtype), Data: make([]byte, len(p))}
+	copy(b.Data, p)
+	v.Set(reflect.ValueOf(b))
+}
+
+func decodeUUID(d *decodeState, kind int, v reflect.Value) {
+	if kind != KindBinary {
+		d.saveErrorAndSkip(kind, v.Type())
+		return
+	}
+	p, subtype := d.scanBinary()
+	if subtype == BinaryUUIDOld {
+		// The byte order of legacy UUIDs depends on the driver that wrote
+		// the value.
+		d.saveError(errors.New("bson: could not decode legacy UUID to " + v.Type().String() + ", decode to mongo.Binary and call Binary.UUID with the representation"))
+		return
+	}
+	if subtype != BinaryUUID || len(p) != 16 {
+		d.saveError(&DecodeConvertError{kind, v.Type()})
+		return
+	}
+	var u UUID
+	copy(u[:], p)
+	v.Set(reflect.ValueOf(u))
+}
+
 func decodeBool(d *decodeState, kind int, v reflect.Value) {
 	var b bool
 	switch kind {
 	default:
 		d.saveErrorAndSkip(kind, v.Type())
 		return
-	case kindBool:
+	case KindBool:
 		b = d.scanBool()
-	case kindInt32:
+	case KindInt32:
 		b = d.scanInt32() != 0
-	case kindInt64:
+	case KindInt64:
 		b = d.scanInt64() != 0
-	case kindFloat:
+	case KindFloat:
 		b = d.scanFloat() != 0
 	}
 	v.SetBool(b)
@@ -390,17 +746,18 @@ func decodeMinMax(d *decodeState, kind int, v reflect.Value) {
 	default:
 		d.saveError(&DecodeConvertError{kind, v.Type()})
 		return
-	case kindMaxValue:
+	case KindMaxValue:
 		n = 1
-	case kindMinValue:
+	case KindMinValue:
 		n = -1
 	}
 	v.SetInt(n)
 }
 
 func decodeMapStringInterface(d *decodeState, kind int, v reflect.Value) {
-	if kind != kindDocument {
+	if kind != KindDocument {
 		d.saveErrorAndSkip(kind, v.Type())
+		return
 	}
 	if v.IsNil() {
 		v.Set(reflect.MakeMap(v.Type()))
@@ -420,7 +777,7 @@ func decodeMapStringInterface(d *decodeState, kind int, v reflect.Value) {
 		if kind == 0 {
 			break
 		}
-		if kind == kindNull {
+		if kind == KindNull && !d.preserveNulls {
 			continue
 		}
 		m[string(name)] = d.decodeValueInterface(kind)
@@ -430,7 +787,7 @@ func decodeMapStringInterface(d *decodeState, kind int, v reflect.Value) {
 
 func decodeMap(d *decodeState, kind int, v reflect.Value) {
 	t := v.Type()
-	if t.Key().Kind() != reflect.String || kind != kindDocument {
+	if !isDecodableMapKey(t.Key()) || kind != KindDocument {
 		d.saveErrorAndSkip(kind, t)
 		return
 	}
@@ -438,36 +795,90 @@ func decodeMap(d *decodeState, kind int, v reflect.Value) {
 		v.Set(reflect.MakeMap(t))
 	}
 	subv := reflect.New(t.Elem()).Elem()
+	skipNulls := !d.preserveNulls && !t.Elem().Implements(typeNullable)
 	offset := d.beginDoc()
 	for {
 		kind, name := d.scanKindName()
 		if kind == 0 {
 			break
 		}
-		if kind == kindNull {
+		if (kind == KindNull || kind == KindUndefined) && skipNulls {
+			continue
+		}
+		key, err := mapKeyValue(t.Key(), name)
+		if err != nil {
+			d.saveError(err)
+			d.skipValue(kind)
 			continue
 		}
 		subv.Set(reflect.Zero(t.Elem()))
+		d.pushPath(name)
 		d.decodeValue(kind, subv)
-		v.SetMapIndex(reflect.ValueOf(string(name)), subv)
+		d.popPath()
+		v.SetMapIndex(key, subv)
 	}
 	d.endDoc(offset)
 }
 
+// isDecodableMapKey returns true if element names can be decoded to map keys
+// of type t.
+func isDecodableMapKey(t reflect.Type) bool {
+	if reflect.PtrTo(t).Implements(typeTextUnmarshaler) {
+		return true
+	}
+	switch t.Kind() {
+	case reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+	return false
+}
+
+// mapKeyValue returns the map key of type t for element name.
+func mapKeyValue(t reflect.Type, name []byte) (reflect.Value, error) {
+	if reflect.PtrTo(t).Implements(typeTextUnmarshaler) {
+		k := reflect.New(t)
+		if err := k.Interface().(encoding.TextUnmarshaler).UnmarshalText(name); err != nil {
+			return reflect.Value{}, err
+		}
+		return k.Elem(), nil
+	}
+	k := reflect.New(t).Elem()
+	switch t.Kind() {
+	case reflect.String:
+		k.SetString(string(name))
+		return k, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(string(name), 10, 64)
+		if err == nil && !k.OverflowInt(n) {
+			k.SetInt(n)
+			return k, nil
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(string(name), 10, 64)
+		if err == nil && !k.OverflowUint(n) {
+			k.SetUint(n)
+			return k, nil
+		}
+	}
+	return reflect.Value{}, errors.New("bson: cannot decode element name " + strconv.Quote(string(name)) + " to map key of type " + t.String())
+}
+
 func decodeSlice(d *decodeState, kind int, v reflect.Value) {
 	t := v.Type()
-	if kind == kindBinary && t.Elem().Kind() == reflect.Uint8 {
+	if kind == KindBinary && t.Elem().Kind() == reflect.Uint8 {
 		decodeByteSlice(d, kind, v)
 		return
 	}
-	if kind != kindArray {
+	if kind != KindArray {
 		d.saveErrorAndSkip(kind, v.Type())
 		return
 	}
 	offset := d.beginDoc()
 	i := 0
 	for {
-		kind, _ := d.scanKindName()
+		kind, name := d.scanKindName()
 		if kind == 0 {
 			break
 		}
@@ -483,7 +894,9 @@ func decodeSlice(d *decodeState, kind int, v reflect.Value) {
 		if i >= v.Len() {
 			v.SetLen(i + 1)
 		}
+		d.pushPath(name)
 		d.decodeValue(kind, v.Index(i))
+		d.popPath()
 		i += 1
 	}
 	if v.IsNil() {
@@ -493,19 +906,21 @@ func decodeSlice(d *decodeState, kind int, v reflect.Value) {
 }
 
 func decodeArray(d *decodeState, kind int, v reflect.Value) {
-	if kind != kindArray {
+	if kind != KindArray {
 		d.saveErrorAndSkip(kind, v.Type())
 		return
 	}
 	offset := d.beginDoc()
 	i := 0
 	for {
-		kind, _ := d.scanKindName()
+		kind, name := d.scanKindName()
 		if kind == 0 {
 			break
 		}
 		if i < v.Len() {
+			d.pushPath(name)
 			d.decodeValue(kind, v.Index(i))
+			d.popPath()
 		} else {
 			d.skipValue(kind)
 		}
@@ -523,16 +938,190 @@ func decodeStruct(d *decodeState, kind int, v reflect.Value) {
 		if kind == 0 {
 			break
 		}
-		if kind == kindNull {
+		fs := ss.fieldSpec(name)
+		if (kind == KindNull || kind == KindUndefined) && !d.preserveNulls && (fs == nil || !fs.nullable) {
 			continue
 		}
-		if fs := ss.fieldSpec(name); fs != nil {
-			d.decodeValue(kind, v.FieldByIndex(fs.index))
+		d.pushPath(name)
+		if fs != nil {
+			if (kind == KindNull || kind == KindUndefined) && d.preserveNulls && d.decodeNull(fieldByIndexAlloc(v, fs.index)) {
+				// The null element is decoded before the field flags are
+				// applied.
+			} else if fs.asString && kind == KindString {
+				d.decodeNumberString(fieldByIndexAlloc(v, fs.index))
+			} else if fs.durationUnit != 0 {
+				d.decodeDurationUnit(kind, fs, fieldByIndexAlloc(v, fs.index))
+			} else {
+				// The truncate flag is only allowed on scalar fields and
+				// Nullable fields of scalars, so the flag does not leak to
+				// nested values.
+				truncate := d.truncate
+				d.truncate = fs.truncate
+				d.decodeValue(kind, fieldByIndexAlloc(v, fs.index))
+				d.truncate = truncate
+			}
+		} else if ss.inlineMap != nil {
+			m := fieldByIndexAlloc(v, ss.inlineMap)
+			if m.IsNil() {
+				m.Set(reflect.MakeMap(m.Type()))
+			}
+			key, err := mapKeyValue(m.Type().Key(), name)
+			if err != nil {
+				d.saveError(err)
+				d.skipValue(kind)
+			} else {
+				subv := reflect.New(m.Type().Elem()).Elem()
+				d.decodeValue(kind, subv)
+				m.SetMapIndex(key, subv)
+			}
 		} else {
+			if d.strict {
+				d.fieldErrors = append(d.fieldErrors, &DecodeFieldError{Path: strings.Join(d.path, "."), Kind: kind})
+			}
 			d.skipValue(kind)
 		}
+		d.popPath()
+	}
+	d.endDoc(offset)
+}
+
+// decodeNumberString decodes a String to a field with the string flag.
+func (d *decodeState) decodeNumberString(v reflect.Value) {
+	s := d.scanString()
+	var err error
+	switch v.Kind() {
+	case reflect.Int64:
+		var n int64
+		if v.Type() == typeDuration {
+			var t time.Duration
+			t, err = time.ParseDuration(s)
+			n = int64(t)
+		} else {
+			n, err = strconv.ParseInt(s, 10, 64)
+		}
+		if err == nil {
+			v.SetInt(n)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32:
+		var n int64
+		n, err = strconv.ParseInt(s, 10, v.Type().Bits())
+		if err == nil {
+			v.SetInt(n)
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		var n uint64
+		n, err = strconv.ParseUint(s, 10, v.Type().Bits())
+		if err == nil {
+			v.SetUint(n)
+		}
+	case reflect.Float32, reflect.Float64:
+		var f float64
+		f, err = strconv.ParseFloat(s, v.Type().Bits())
+		if err == nil {
+			v.SetFloat(f)
+		}
+	}
+	if err != nil {
+		d.saveError(&DecodeConvertError{KindString, v.Type()})
+	}
+}
+
+// decodeDurationUnit decodes a count of fs.durationUnit to a time.Duration for
+// the millis and seconds field flags. A Double is converted using its shortest
+// decimal representation so that values such as 1.005 seconds are exact.
+// Digits smaller than a nanosecond are discarded.
+func (d *decodeState) decodeDurationUnit(kind int, fs *fieldSpec, v reflect.Value) {
+	unit := fs.durationUnit
+	var i int64
+	switch kind {
+	default:
+		d.saveErrorAndSkip(kind, v.Type())
+		return
+	case KindInt32:
+		i = int64(d.scanInt32())
+	case KindInt64:
+		i = d.scanInt64()
+	case KindFloat:
+		// The number of fractional digits in a nanosecond count of unit.
+		digits := len(strconv.FormatInt(int64(unit), 10)) - 1
+		s := strconv.FormatFloat(d.scanFloat(), 'f', -1, 64)
+		whole, frac, _ := strings.Cut(s, ".")
+		if len(frac) > digits {
+			if d.strictPrecision && !fs.truncate {
+				d.saveError(&DecodeConvertError{kind, v.Type()})
+				return
+			}
+			frac = frac[:digits]
+		}
+		n, err := strconv.ParseInt(whole+frac+strings.Repeat("0", digits-len(frac)), 10, 64)
+		if err != nil {
+			d.saveError(&DecodeConvertError{kind, v.Type()})
+			return
+		}
+		v.SetInt(n)
+		return
+	}
+	if i > math.MaxInt64/int64(unit) || i < math.MinInt64/int64(unit) {
+		d.saveError(&DecodeConvertError{kind, v.Type()})
+		return
+	}
+	v.SetInt(i * int64(unit))
+}
+
+// scanD appends the elements of a document to doc.
+func (d *decodeState) scanD(doc D) D {
+	if doc == nil {
+		doc = make(D, 0)
+	}
+	offset := d.beginDoc()
+	for {
+		kind, name := d.scanKindName()
+		if kind == 0 {
+			break
+		}
+		doc = append(doc, DocItem{string(name), d.decodeValueInterface(kind)})
+	}
+	d.endDoc(offset)
+	return doc
+}
+
+// scanA appends the elements of an array to a.
+func (d *decodeState) scanA(a A) A {
+	if a == nil {
+		a = make(A, 0)
+	}
+	offset := d.beginDoc()
+	for {
+		kind, _ := d.scanKindName()
+		if kind == 0 {
+			break
+		}
+		a = append(a, d.decodeValueInterface(kind))
 	}
 	d.endDoc(offset)
+	return a
+}
+
+func decodeD(d *decodeState, kind int, v reflect.Value) {
+	if kind != KindDocument {
+		d.saveErrorAndSkip(kind, v.Type())
+		return
+	}
+	ordered := d.ordered
+	d.ordered = true
+	v.Set(reflect.ValueOf(d.scanD(v.Interface().(D)[:0])))
+	d.ordered = ordered
+}
+
+func decodeA(d *decodeState, kind int, v reflect.Value) {
+	if kind != KindArray {
+		d.saveErrorAndSkip(kind, v.Type())
+		return
+	}
+	ordered := d.ordered
+	d.ordered = true
+	v.Set(reflect.ValueOf(d.scanA(v.Interface().(A)[:0])))
+	d.ordered = ordered
 }
 
 func decodeInterface(d *decodeState, kind int, v reflect.Value) {
@@ -541,11 +1130,14 @@ func decodeInterface(d *decodeState, kind int, v reflect.Value) {
 
 func (d *decodeState) decodeValueInterface(kind int) interface{} {
 	switch kind {
-	case kindFloat:
+	case KindFloat:
 		return d.scanFloat()
-	case kindString:
+	case KindString:
 		return d.scanString()
-	case kindDocument:
+	case KindDocument:
+		if d.ordered {
+			return d.scanD(nil)
+		}
 		m := make(map[string]interface{})
 		offset := d.beginDoc()
 		for {
@@ -557,7 +1149,10 @@ func (d *decodeState) decodeValueInterface(kind int) interface{} {
 		}
 		d.endDoc(offset)
 		return m
-	case kindArray:
+	case KindArray:
+		if d.ordered {
+			return d.scanA(nil)
+		}
 		a := make([]interface{}, 0)
 		offset := d.beginDoc()
 		for {
@@ -569,30 +1164,55 @@ func (d *decodeState) decodeValueInterface(kind int) interface{} {
 		}
 		d.endDoc(offset)
 		return a
-	case kindBinary:
-		p, _ := d.scanBinary()
-		newp := make([]byte, len(p))
-		copy(newp, p)
-		return newp
-	case kindObjectId:
+	case KindBinary:
+		p, subtype := d.scanBinary()
+		switch {
+		case subtype == BinaryGeneric || (subtype == BinaryOld && !d.ordered):
+			newp := make([]byte, len(p))
+			copy(newp, p)
+			return newp
+		case subtype == BinaryUUID && len(p) == 16:
+			var u UUID
+			copy(u[:], p)
+			return u
+		}
+		b := Binary{Subtype: byte(subtype), Data: make([]byte, len(p))}
+		copy(b.Data, p)
+		return b
+	case KindObjectId:
 		return ObjectId(string(d.scanSlice(12)))
-	case kindBool:
+	case KindBool:
 		return d.scanBool()
-	case kindDateTime:
-		return timeFromMS(d.scanInt64())
-	case kindNull:
+	case KindDateTime:
+		return d.scanTime()
+	case KindNull:
+		if d.ordered {
+			return BSONData{Kind: KindNull}
+		}
 		return nil
-	case kindSymbol:
+	case KindUndefined:
+		return Undefined{}
+	case KindRegexp:
+		return d.scanRegexp()
+	case KindDBPointer:
+		return d.scanDBPointer()
+	case KindCode:
+		return Code(d.scanString())
+	case KindSymbol:
 		return Symbol(d.scanString())
-	case kindInt32:
+	case KindCodeWithScope:
+		return d.scanCodeWithScope()
+	case KindInt32:
 		return int(d.scanInt32())
-	case kindTimestamp:
+	case KindTimestamp:
 		return Timestamp(d.scanInt64())
-	case kindInt64:
+	case KindInt64:
 		return d.scanInt64()
-	case kindMinValue:
+	case KindDecimal128:
+		return d.scanDecimal128()
+	case KindMinValue:
 		return MinValue
-	case kindMaxValue:
+	case KindMaxValue:
 		return MaxValue
 	default:
 		abort(&DecodeTypeError{kind})
@@ -602,24 +1222,32 @@ func (d *decodeState) decodeValueInterface(kind int) interface{} {
 
 func (d *decodeState) skipValue(kind int) {
 	switch kind {
-	case kindString, kindSymbol:
+	case KindString, KindSymbol, KindCode:
 		n := int(d.scanInt32())
 		d.offset += n
-	case kindDocument, kindArray:
+	case KindDocument, KindArray, KindCodeWithScope:
 		n := int(d.scanInt32())
 		d.offset += n - 4
-	case kindBinary:
+	case KindBinary:
 		n := int(d.scanInt32())
 		d.offset += n + 1
-	case kindObjectId:
+	case KindObjectId:
 		d.offset += 12
-	case kindBool:
+	case KindBool:
 		d.offset += 1
-	case kindDateTime, kindTimestamp, kindInt64, kindFloat:
+	case KindDateTime, KindTimestamp, KindInt64, KindFloat:
 		d.offset += 8
-	case kindInt32:
+	case KindInt32:
 		d.offset += 4
-	case kindMinValue, kindMaxValue, kindNull:
+	case KindDecimal128:
+		d.offset += 16
+	case KindRegexp:
+		d.skipCString()
+		d.skipCString()
+	case KindDBPointer:
+		n := int(d.scanInt32())
+		d.offset += n + 12
+	case KindMinValue, KindMaxValue, KindNull, KindUndefined:
 		d.offset += 0
 	default:
 		abort(&DecodeTypeError{kind})
@@ -654,11 +1282,21 @@ func init() {
 	}
 	typeDecoder = map[reflect.Type]decoderFunc{
 		reflect.TypeOf(BSONData{}):                   decodeBSONData,
+		reflect.TypeOf(D{}):                          decodeD,
+		reflect.TypeOf(A{}):                          decodeA,
+		reflect.TypeOf(CodeWithScope{}):              decodeCodeWithScope,
+		reflect.TypeOf(DBPointer{}):                  decodeDBPointer,
+		reflect.TypeOf(Regexp{}):                     decodeRegexp,
+		reflect.TypeOf(Undefined{}):                  decodeUndefined,
+		reflect.TypeOf(Binary{}):                     decodeBinary,
+		reflect.TypeOf(Raw(nil)):                     decodeRaw,
 		reflect.TypeOf(time.Time{}):                  decodeTime,
+		reflect.TypeOf(Decimal128{}):                 decodeDecimal128,
 		reflect.TypeOf(MinMax(0)):                    decodeMinMax,
 		reflect.TypeOf(ObjectId("")):                 decodeObjectId,
 		reflect.TypeOf(Symbol("")):                   decodeString,
 		reflect.TypeOf(Timestamp(0)):                 decodeTimestamp,
+		reflect.TypeOf(UUID{}):                       decodeUUID,
 		reflect.TypeOf(make(map[string]interface{})): decodeMapStringInterface,
 		reflect.TypeOf(M{}):                          decodeMapStringInterface,
 		reflect.TypeOf(new(interface{})).Elem():      decodeInterface,
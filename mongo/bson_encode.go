@@ -15,18 +15,26 @@
 package mongo
 
 import (
+	"encoding"
 	"errors"
 	"math"
 	"reflect"
+	"sort"
 	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
 var (
 	typeD        = reflect.TypeOf(D{})
 	typeBSONData = reflect.TypeOf(BSONData{})
-	idKey        = reflect.ValueOf("_id")
+	typeRaw      = reflect.TypeOf(Raw(nil))
 	itoas        = [...]string{"0", "1", "2", "3", "4", "5", "6", "7", "8", "9", "10"}
+
+	// encodeSizeHint is the size of the last document encoded to a pooled
+	// buffer.
+	encodeSizeHint int32
 )
 
 // EncodeTypeError is the error indicating that Encode could not encode an input type.
@@ -40,6 +48,17 @@ func (e *EncodeTypeError) Error() string {
 
 type encodeState struct {
 	buffer
+	registry        *Registry
+	sortKeys        bool
+	strictPrecision bool // report loss of time precision as an error
+}
+
+var encodeStatePool = sync.Pool{New: func() interface{} { return new(encodeState) }}
+
+// release clears the state and returns it to the pool.
+func (e *encodeState) release() {
+	*e = encodeState{}
+	encodeStatePool.Put(e)
 }
 
 // Encode appends the BSON encoding of doc to buf and returns the new slice.
@@ -57,12 +76,51 @@ type encodeState struct {
 //  omitempty   If the field is the zero value, then the field is not
 //              written to the encoding.
 //
+//  minsize     If the field is an int64 or uint64 and the value fits in
+//              an Integer32, then the value is encoded as an Integer32.
+//              The flag is allowed on int, int64, uint and uint64 fields.
+//
+//  truncate    Allow the field to lose precision when the StrictPrecision
+//              encode or decode option is set. Without the option, the
+//              precision is always lost silently: a time.Time is truncated
+//              to milliseconds, a time.Duration with the millis or seconds
+//              flag is truncated to the unit, and the fractional part of a
+//              Double decoded to an integer or time.Duration is discarded.
+//              The flag is allowed on integer, time.Duration and time.Time
+//              fields.
+//
+//  string      The integer or floating point field is encoded as a
+//              String. When decoding, the field is parsed from a String.
+//              A time.Duration field is encoded in the format of the
+//              Duration String method, for example "1h30m", and is parsed
+//              with time.ParseDuration.
+//
+//  millis      The time.Duration field is encoded as an Integer64 count
+//              of milliseconds. When decoding, the field is converted from
+//              a number of milliseconds.
+//
+//  seconds     The time.Duration field is encoded as an Integer64 count
+//              of seconds. When decoding, the field is converted from a
+//              number of seconds.
+//
+//  inline      If the field is a struct, then the fields of the struct are
+//              encoded in-line with the containing struct. If the field is
+//              a map, then the map entries are encoded in-line with the
+//              containing struct and document elements that do not match a
+//              struct field are decoded to the map. The map keys are
+//              converted as described below for maps. A struct may have at
+//              most one inline map.
+//
 // Anonymous struct fields are encoded in-line with the containing struct.
 //
 // Array and slice values encode as BSON arrays.
 //
-// Map values encode as BSON documents. The map's key type must be string; the
-// object keys are used directly as map keys.
+// Map values encode as BSON documents. The map's key type must be a string
+// type, an integer type or implement the encoding.TextMarshaler interface.
+// String keys are used directly as element names, integer keys are formatted
+// in decimal and TextMarshaler keys use the value returned by MarshalText. The
+// TextMarshaler interface has precedence over the key's kind. The map keys
+// are encoded in unspecified order unless the SortKeys encode option is set.
 //
 // Pointer values encode as the value pointed to.
 //
@@ -79,39 +137,121 @@ type encodeState struct {
 //      uint8, uint16       -> Integer32
 //      int64, uint64       -> Integer64
 //      string              -> String
-//      []byte              -> Binary data
-//      time.Time           -> UTC Datetime
+//      []byte              -> Binary data with generic subtype
+//      mongo.Binary        -> Binary data with given subtype
+//      mongo.UUID          -> Binary data with UUID subtype
+//      time.Time           -> UTC Datetime truncated to milliseconds
+//      time.Duration       -> Integer64 count of nanoseconds
 //      mongo.Code          -> Javascript code
 //      mongo.CodeWithScope -> Javascript code with scope
 //      mongo.D             -> Document. Use when element order is important.
+//      mongo.DBPointer     -> DBPointer (deprecated)
+//      mongo.Decimal128    -> Decimal128
 //      mongo.MinMax        -> Minimum / Maximum value
 //      mongo.ObjectId      -> ObjectId
+//      mongo.Raw           -> Document
 //      mongo.Regexp        -> Regular expression
 //      mongo.Symbol        -> Symbol
 //      mongo.Timestamp     -> Timestamp
+//      mongo.Undefined     -> Undefined (deprecated)
+//
+// Types that implement the Marshaler interface encode as the value returned by
+// the MarshalBSONValue method. Types that implement the DocumentMarshaler
+// interface encode as the document returned by the MarshalBSON method. If the
+// marshal method has a pointer receiver, then the method is called for
+// addressable values only.
 //
 // Other types including channels, complex and function values cannot be encoded.
 //
+// Encode appends to buf. To encode without allocating, pass a buffer from
+// GetBuffer and return the buffer to the pool with PutBuffer when done.
+//
 // BSON cannot represent cyclic data structure and Encode does not handle them.
 // Passing cyclic structures to Encode will result in an infinite recursion.
 func Encode(buf []byte, doc interface{}) (result []byte, err error) {
+	return EncodeWithOptions(buf, doc, nil)
+}
+
+// EncodeOptions specifies options for EncodeWithOptions.
+type EncodeOptions struct {
+	// Registry of additional encoders. If nil, then only the built-in
+	// encodings are used.
+	Registry *Registry
+
+	// If SortKeys is true, then map keys are encoded in sorted order so that
+	// the encoding of a map is deterministic. The _id element of a top-level
+	// document is encoded first.
+	SortKeys bool
+
+	// If StrictPrecision is true, then encoding a time.Time with
+	// sub-millisecond precision, or a time.Duration that is not a whole
+	// number of the field's millis or seconds unit, is an error unless the
+	// field has the truncate flag. Otherwise, the values are truncated.
+	StrictPrecision bool
+}
+
+// EncodeWithOptions appends the BSON encoding of doc to buf using the given
+// options. See the Encode function for more information about BSON encoding.
+//
+// The options do not apply to the encoding returned by the methods of the
+// Marshaler and DocumentMarshaler interfaces.
+func EncodeWithOptions(buf []byte, doc interface{}, options *EncodeOptions) (result []byte, err error) {
 	defer handleAbort(&err)
 
+	switch m := doc.(type) {
+	case DocumentMarshaler:
+		data, err := m.MarshalBSON()
+		if err == nil {
+			err = checkMarshalerData(KindDocument, data)
+		}
+		if err != nil {
+			return nil, &MarshalerError{reflect.TypeOf(doc), err}
+		}
+		return append(buf, data...), nil
+	case Marshaler:
+		kind, data, err := m.MarshalBSONValue()
+		if err != nil {
+			return nil, &MarshalerError{reflect.TypeOf(doc), err}
+		}
+		if kind != KindDocument {
+			return nil, &EncodeTypeError{reflect.TypeOf(doc)}
+		}
+		if err := checkMarshalerData(kind, data); err != nil {
+			return nil, &MarshalerError{reflect.TypeOf(doc), err}
+		}
+		return append(buf, data...), nil
+	}
+
 	v := reflect.ValueOf(doc)
 	if kind := v.Kind(); kind == reflect.Interface || kind == reflect.Ptr {
 		v = v.Elem()
 	}
 
-	e := encodeState{buffer: buf}
+	e := encodeStatePool.Get().(*encodeState)
+	defer e.release()
+	e.buffer = buf
+	if buf == nil {
+		// Encode to a pooled buffer and copy the result to an allocation of
+		// the exact size. The size of the previous document is used to pick
+		// a buffer that is likely to be large enough.
+		e.buffer = GetBuffer(int(atomic.LoadInt32(&encodeSizeHint)))
+	}
+	if options != nil {
+		e.registry = options.Registry
+		e.sortKeys = options.SortKeys
+		e.strictPrecision = options.StrictPrecision
+	}
 	switch v.Type() {
 	case typeD:
 		e.writeD(v.Interface().(D))
 	case typeBSONData:
 		bd := v.Interface().(BSONData)
-		if bd.Kind != kindDocument {
+		if bd.Kind != KindDocument {
 			return nil, &EncodeTypeError{v.Type()}
 		}
 		e.Write(bd.Data)
+	case typeRaw:
+		e.Write(v.Interface().(Raw))
 	default:
 		switch v.Kind() {
 		case reflect.Struct:
@@ -122,6 +262,12 @@ func Encode(buf []byte, doc interface{}) (result []byte, err error) {
 			return nil, &EncodeTypeError{v.Type()}
 		}
 	}
+	if buf == nil {
+		atomic.StoreInt32(&encodeSizeHint, int32(len(e.buffer)))
+		result = append([]byte(nil), e.buffer...)
+		PutBuffer(e.buffer)
+		return result, nil
+	}
 	return e.buffer, nil
 }
 
@@ -145,7 +291,28 @@ func (e *encodeState) writeStruct(v reflect.Value) {
 	offset := e.beginDoc()
 	ss := structSpecForType(v.Type())
 	for _, fs := range ss.l {
-		e.encodeValue(fs.name, fs, v.FieldByIndex(fs.index))
+		fv, err := v.FieldByIndexErr(fs.index)
+		if err != nil {
+			// The field is in a nil embedded struct pointer.
+			continue
+		}
+		if fs.asString {
+			encodeNumberString(e, fs.name, fs, fv)
+		} else if fs.durationUnit != 0 {
+			encodeDurationUnit(e, fs.name, fs, fv)
+		} else {
+			e.encodeValue(fs.name, fs, fv)
+		}
+	}
+	if ss.inlineMap != nil {
+		if m, err := v.FieldByIndexErr(ss.inlineMap); err == nil {
+			for _, me := range e.mapEntries(m) {
+				if _, found := ss.m[me.name]; found {
+					abort(errors.New("bson: inline map key " + me.name + " conflicts with struct field"))
+				}
+				e.encodeValue(me.name, defaultFieldSpec, me.value)
+			}
+		}
 	}
 	e.WriteByte(0)
 	e.endDoc(offset)
@@ -155,28 +322,87 @@ func (e *encodeState) writeMap(v reflect.Value, topLevel bool) {
 	if v.IsNil() {
 		return
 	}
-	if v.Type().Key().Kind() != reflect.String {
+	if !isEncodableMapKey(v.Type().Key()) {
 		abort(&EncodeTypeError{v.Type()})
 	}
 	offset := e.beginDoc()
-	skipId := false
+	entries := e.mapEntries(v)
 	if topLevel {
-		idValue := v.MapIndex(idKey)
-		if idValue.IsValid() {
-			skipId = true
-			e.encodeValue("_id", defaultFieldSpec, idValue)
+		for _, me := range entries {
+			if me.name == "_id" {
+				e.encodeValue("_id", defaultFieldSpec, me.value)
+			}
 		}
 	}
-	for _, k := range v.MapKeys() {
-		sk := k.String()
-		if !skipId || sk != "_id" {
-			e.encodeValue(sk, defaultFieldSpec, v.MapIndex(k))
+	for _, me := range entries {
+		if !topLevel || me.name != "_id" {
+			e.encodeValue(me.name, defaultFieldSpec, me.value)
 		}
 	}
 	e.WriteByte(0)
 	e.endDoc(offset)
 }
 
+type mapEntry struct {
+	name  string
+	value reflect.Value
+}
+
+// mapEntries returns the element names and values of map v, sorted by name
+// if the SortKeys option is set.
+func (e *encodeState) mapEntries(v reflect.Value) []mapEntry {
+	entries := make([]mapEntry, 0, v.Len())
+	iter := v.MapRange()
+	for iter.Next() {
+		entries = append(entries, mapEntry{mapKeyName(iter.Key()), iter.Value()})
+	}
+	if e.sortKeys {
+		sort.Slice(entries, func(i, j int) bool { return entries[i].name < entries[j].name })
+	}
+	return entries
+}
+
+// isEncodableMapKey returns true if map keys of type t can be encoded as
+// element names. Keys can be strings, integers or implement
+// encoding.TextMarshaler.
+func isEncodableMapKey(t reflect.Type) bool {
+	if t.Implements(typeTextMarshaler) {
+		return true
+	}
+	switch t.Kind() {
+	case reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+	return false
+}
+
+// mapKeyName returns the element name for map key k. As with encoding/json,
+// the encoding.TextMarshaler interface has precedence over the key's kind.
+func mapKeyName(k reflect.Value) string {
+	if k.Type().Implements(typeTextMarshaler) {
+		if k.Kind() == reflect.Ptr && k.IsNil() {
+			return ""
+		}
+		p, err := k.Interface().(encoding.TextMarshaler).MarshalText()
+		if err != nil {
+			abort(&MarshalerError{k.Type(), err})
+		}
+		return string(p)
+	}
+	switch k.Kind() {
+	case reflect.String:
+		return k.String()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(k.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(k.Uint(), 10)
+	}
+	abort(&EncodeTypeError{k.Type()})
+	panic("unreachable")
+}
+
 func (e *encodeState) writeD(v D) {
 	offset := e.beginDoc()
 	for _, kv := range v {
@@ -191,11 +417,20 @@ func (e *encodeState) encodeValue(name string, fs *fieldSpec, v reflect.Value) {
 		return
 	}
 	t := v.Type()
+	if e.registry != nil {
+		if encoder := e.registry.encoder(t); encoder != nil {
+			encoder(e, name, fs, v)
+			return
+		}
+	}
 	encoder, found := typeEncoder[t]
 	if !found {
-		encoder, found = kindEncoder[t.Kind()]
-		if !found {
-			abort(&EncodeTypeError{t})
+		encoder = marshalerEncoder(t)
+		if encoder == nil {
+			encoder, found = kindEncoder[t.Kind()]
+			if !found {
+				abort(&EncodeTypeError{t})
+			}
 		}
 	}
 	encoder(e, name, fs, v)
@@ -206,7 +441,7 @@ func encodeBool(e *encodeState, name string, fs *fieldSpec, v reflect.Value) {
 	if b == false && fs.omitEmpty {
 		return
 	}
-	e.writeKindName(kindBool, name)
+	e.writeKindName(KindBool, name)
 	if b {
 		e.WriteByte(1)
 	} else {
@@ -220,10 +455,10 @@ func encodeInt(e *encodeState, name string, fs *fieldSpec, v reflect.Value) {
 		return
 	}
 	if i >= math.MinInt32 && i <= math.MaxInt32 {
-		e.writeKindName(kindInt32, name)
+		e.writeKindName(KindInt32, name)
 		e.WriteUint32(uint32(i))
 	} else {
-		e.writeKindName(kindInt64, name)
+		e.writeKindName(KindInt64, name)
 		e.WriteUint64(uint64(i))
 	}
 }
@@ -233,7 +468,7 @@ func encodeUint16(e *encodeState, name string, fs *fieldSpec, v reflect.Value) {
 	if u == 0 && fs.omitEmpty {
 		return
 	}
-	e.writeKindName(kindInt32, name)
+	e.writeKindName(KindInt32, name)
 	e.WriteUint32(uint32(u))
 }
 
@@ -246,10 +481,10 @@ func encodeUint(e *encodeState, name string, fs *fieldSpec, v reflect.Value) {
 		abort(errors.New("bson: uint value does not fit in int64"))
 	}
 	if u <= math.MaxInt32 {
-		e.writeKindName(kindInt32, name)
+		e.writeKindName(KindInt32, name)
 		e.WriteUint32(uint32(u))
 	} else {
-		e.writeKindName(kindInt64, name)
+		e.writeKindName(KindInt64, name)
 		e.WriteUint64(uint64(u))
 	}
 }
@@ -259,7 +494,7 @@ func encodeInt32(e *encodeState, name string, fs *fieldSpec, v reflect.Value) {
 	if i == 0 && fs.omitEmpty {
 		return
 	}
-	e.writeKindName(kindInt32, name)
+	e.writeKindName(KindInt32, name)
 	e.WriteUint32(uint32(i))
 }
 
@@ -268,6 +503,11 @@ func encodeInt64(e *encodeState, kind int, name string, fs *fieldSpec, v reflect
 	if i == 0 && fs.omitEmpty {
 		return
 	}
+	if kind == KindInt64 && fs.minSize && i >= math.MinInt32 && i <= math.MaxInt32 {
+		e.writeKindName(KindInt32, name)
+		e.WriteUint32(uint32(i))
+		return
+	}
 	e.writeKindName(kind, name)
 	e.WriteUint64(uint64(i))
 }
@@ -280,7 +520,12 @@ func encodeUint64(e *encodeState, name string, fs *fieldSpec, v reflect.Value) {
 	if int64(u) < 0 {
 		abort(errors.New("bson: uint64 value does not fit in int64"))
 	}
-	e.writeKindName(kindInt64, name)
+	if fs.minSize && u <= math.MaxInt32 {
+		e.writeKindName(KindInt32, name)
+		e.WriteUint32(uint32(u))
+		return
+	}
+	e.writeKindName(KindInt64, name)
 	e.WriteUint64(u)
 }
 
@@ -289,7 +534,7 @@ func encodeFloat(e *encodeState, name string, fs *fieldSpec, v reflect.Value) {
 	if f == 0 && fs.omitEmpty {
 		return
 	}
-	e.writeKindName(kindFloat, name)
+	e.writeKindName(KindFloat, name)
 	e.WriteUint64(math.Float64bits(f))
 }
 
@@ -303,25 +548,75 @@ func encodeString(e *encodeState, kind int, name string, fs *fieldSpec, v reflec
 	e.WriteCString(s)
 }
 
+// encodeNumberString encodes a number as a string for the string field flag.
+func encodeNumberString(e *encodeState, name string, fs *fieldSpec, v reflect.Value) {
+	var s string
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if v.Int() == 0 && fs.omitEmpty {
+			return
+		}
+		if v.Type() == typeDuration {
+			s = time.Duration(v.Int()).String()
+		} else {
+			s = strconv.FormatInt(v.Int(), 10)
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if v.Uint() == 0 && fs.omitEmpty {
+			return
+		}
+		s = strconv.FormatUint(v.Uint(), 10)
+	case reflect.Float32, reflect.Float64:
+		if v.Float() == 0 && fs.omitEmpty {
+			return
+		}
+		s = strconv.FormatFloat(v.Float(), 'g', -1, v.Type().Bits())
+	}
+	e.writeKindName(KindString, name)
+	e.WriteUint32(uint32(len(s) + 1))
+	e.WriteCString(s)
+}
+
 func encodeRegexp(e *encodeState, name string, fs *fieldSpec, v reflect.Value) {
 	r := v.Interface().(Regexp)
 	if r.Pattern == "" && fs.omitEmpty {
 		return
 	}
-	e.writeKindName(kindRegexp, name)
+	e.writeKindName(KindRegexp, name)
 	e.WriteCString(r.Pattern)
 	e.WriteCString(r.Options)
 }
 
+func encodeUndefined(e *encodeState, name string, fs *fieldSpec, v reflect.Value) {
+	if fs.omitEmpty {
+		return
+	}
+	e.writeKindName(KindUndefined, name)
+}
+
+func encodeDBPointer(e *encodeState, name string, fs *fieldSpec, v reflect.Value) {
+	p := v.Interface().(DBPointer)
+	if p.Namespace == "" && p.Id == "" && fs.omitEmpty {
+		return
+	}
+	if len(p.Id) != 12 {
+		abort(errors.New("bson: object id length != 12"))
+	}
+	e.writeKindName(KindDBPointer, name)
+	e.WriteUint32(uint32(len(p.Namespace) + 1))
+	e.WriteCString(p.Namespace)
+	copy(e.Next(12), p.Id)
+}
+
 func encodeObjectId(e *encodeState, name string, fs *fieldSpec, v reflect.Value) {
-	oid := v.Interface().(ObjectId)
+	oid := ObjectId(v.String())
 	if oid == "" {
 		return
 	}
 	if len(oid) != 12 {
 		abort(errors.New("bson: object id length != 12"))
 	}
-	e.writeKindName(kindObjectId, name)
+	e.writeKindName(KindObjectId, name)
 	copy(e.Next(12), oid)
 }
 
@@ -339,7 +634,7 @@ func encodeCodeWithScope(e *encodeState, name string, fs *fieldSpec, v reflect.V
 	if c.Code == "" && c.Scope == nil && fs.omitEmpty {
 		return
 	}
-	e.writeKindName(kindCodeWithScope, name)
+	e.writeKindName(KindCodeWithScope, name)
 	offset := e.beginDoc()
 	e.WriteUint32(uint32(len(c.Code) + 1))
 	e.WriteCString(c.Code)
@@ -359,25 +654,62 @@ func encodeMinMax(e *encodeState, name string, fs *fieldSpec, v reflect.Value) {
 	}
 	switch v.Interface().(MinMax) {
 	case 1:
-		e.writeKindName(kindMaxValue, name)
+		e.writeKindName(KindMaxValue, name)
 	case -1:
-		e.writeKindName(kindMinValue, name)
+		e.writeKindName(KindMinValue, name)
 	default:
 		abort(errors.New("bson: unknown MinMax value"))
 	}
 }
 
+func encodeDecimal128(e *encodeState, name string, fs *fieldSpec, v reflect.Value) {
+	d := v.Interface().(Decimal128)
+	if d == (Decimal128{}) && fs.omitEmpty {
+		return
+	}
+	e.writeKindName(KindDecimal128, name)
+	e.WriteUint64(d.l)
+	e.WriteUint64(d.h)
+}
+
 func encodeTime(e *encodeState, name string, fs *fieldSpec, v reflect.Value) {
-	t := v.Interface().(time.Time)
+	var t time.Time
+	if v.CanAddr() {
+		// Avoid allocating a copy of the value.
+		t = *v.Addr().Interface().(*time.Time)
+	} else {
+		t = v.Interface().(time.Time)
+	}
 	if t.IsZero() && fs.omitEmpty {
 		return
 	}
-	e.writeKindName(kindDateTime, name)
+	if e.strictPrecision && !fs.truncate && t.Nanosecond()%int(time.Millisecond) != 0 {
+		abort(errors.New("bson: time " + t.String() + " has sub-millisecond precision"))
+	}
+	e.writeKindName(KindDateTime, name)
 	e.WriteUint64(uint64(msFromTime(t)))
 }
 
+// encodeDurationUnit encodes a time.Duration as a count of fs.durationUnit
+// for the millis and seconds field flags.
+func encodeDurationUnit(e *encodeState, name string, fs *fieldSpec, v reflect.Value) {
+	d := time.Duration(v.Int())
+	if d == 0 && fs.omitEmpty {
+		return
+	}
+	if e.strictPrecision && !fs.truncate && d%fs.durationUnit != 0 {
+		unit := "seconds"
+		if fs.durationUnit == time.Millisecond {
+			unit = "milliseconds"
+		}
+		abort(errors.New("bson: duration " + d.String() + " is not a whole number of " + unit))
+	}
+	e.writeKindName(KindInt64, name)
+	e.WriteUint64(uint64(d / fs.durationUnit))
+}
+
 func encodeStruct(e *encodeState, name string, fs *fieldSpec, v reflect.Value) {
-	e.writeKindName(kindDocument, name)
+	e.writeKindName(KindDocument, name)
 	e.writeStruct(v)
 }
 
@@ -385,7 +717,7 @@ func encodeMap(e *encodeState, name string, fs *fieldSpec, v reflect.Value) {
 	if v.IsNil() {
 		return
 	}
-	e.writeKindName(kindDocument, name)
+	e.writeKindName(KindDocument, name)
 	e.writeMap(v, false)
 }
 
@@ -394,7 +726,7 @@ func encodeD(e *encodeState, name string, fs *fieldSpec, v reflect.Value) {
 	if d == nil {
 		return
 	}
-	e.writeKindName(kindDocument, name)
+	e.writeKindName(KindDocument, name)
 	e.writeD(d)
 }
 
@@ -403,12 +735,40 @@ func encodeByteSlice(e *encodeState, name string, fs *fieldSpec, v reflect.Value
 	if b == nil {
 		return
 	}
-	e.writeKindName(kindBinary, name)
-	e.WriteUint32(uint32(len(b)))
-	e.WriteByte(0)
+	e.writeKindName(KindBinary, name)
+	e.writeBinary(BinaryGeneric, b)
+}
+
+func (e *encodeState) writeBinary(subtype byte, b []byte) {
+	if subtype == BinaryOld {
+		e.WriteUint32(uint32(len(b) + 4))
+		e.WriteByte(subtype)
+		e.WriteUint32(uint32(len(b)))
+	} else {
+		e.WriteUint32(uint32(len(b)))
+		e.WriteByte(subtype)
+	}
 	e.Write(b)
 }
 
+func encodeBinary(e *encodeState, name string, fs *fieldSpec, v reflect.Value) {
+	b := v.Interface().(Binary)
+	if b.Subtype == 0 && b.Data == nil && fs.omitEmpty {
+		return
+	}
+	e.writeKindName(KindBinary, name)
+	e.writeBinary(b.Subtype, b.Data)
+}
+
+func encodeUUID(e *encodeState, name string, fs *fieldSpec, v reflect.Value) {
+	u := v.Interface().(UUID)
+	if u == (UUID{}) && fs.omitEmpty {
+		return
+	}
+	e.writeKindName(KindBinary, name)
+	e.writeBinary(BinaryUUID, u[:])
+}
+
 func encodeSlice(e *encodeState, name string, fs *fieldSpec, v reflect.Value) {
 	if v.IsNil() {
 		return
@@ -421,7 +781,7 @@ func encodeSlice(e *encodeState, name string, fs *fieldSpec, v reflect.Value) {
 }
 
 func encodeArray(e *encodeState, name string, fs *fieldSpec, v reflect.Value) {
-	e.writeKindName(kindArray, name)
+	e.writeKindName(KindArray, name)
 	offset := e.beginDoc()
 	n := v.Len()
 	if n < len(itoas) {
@@ -466,33 +826,39 @@ func init() {
 		reflect.Uint64:  encodeUint64,
 		reflect.Uint:    encodeUint,
 		reflect.Int64: func(e *encodeState, name string, fs *fieldSpec, value reflect.Value) {
-			encodeInt64(e, kindInt64, name, fs, value)
+			encodeInt64(e, KindInt64, name, fs, value)
 		},
 		reflect.Interface: encodeInterfaceOrPtr,
 		reflect.Map:       encodeMap,
 		reflect.Ptr:       encodeInterfaceOrPtr,
 		reflect.Slice:     encodeSlice,
 		reflect.String: func(e *encodeState, name string, fs *fieldSpec, value reflect.Value) {
-			encodeString(e, kindString, name, fs, value)
+			encodeString(e, KindString, name, fs, value)
 		},
 		reflect.Struct: encodeStruct,
 	}
 	typeEncoder = map[reflect.Type]encoderFunc{
 		typeD:        encodeD,
 		typeBSONData: encodeBSONData,
+		typeRaw:      encodeRaw,
 		reflect.TypeOf(Code("")): func(e *encodeState, name string, fs *fieldSpec, value reflect.Value) {
-			encodeString(e, kindCode, name, fs, value)
+			encodeString(e, KindCode, name, fs, value)
 		},
+		reflect.TypeOf(Binary{}):        encodeBinary,
 		reflect.TypeOf(CodeWithScope{}): encodeCodeWithScope,
+		reflect.TypeOf(DBPointer{}):     encodeDBPointer,
+		reflect.TypeOf(Decimal128{}):    encodeDecimal128,
 		reflect.TypeOf(time.Time{}):     encodeTime,
 		reflect.TypeOf(MinMax(0)):       encodeMinMax,
 		reflect.TypeOf(ObjectId("")):    encodeObjectId,
 		reflect.TypeOf(Regexp{}):        encodeRegexp,
 		reflect.TypeOf(Symbol("")): func(e *encodeState, name string, fs *fieldSpec, value reflect.Value) {
-			encodeString(e, kindSymbol, name, fs, value)
+			encodeString(e, KindSymbol, name, fs, value)
 		},
+		reflect.TypeOf(UUID{}):       encodeUUID,
+		reflect.TypeOf(Undefined{}):  encodeUndefined,
 		reflect.TypeOf(Timestamp(0)): func(e *encodeState, name string, fs *fieldSpec, value reflect.Value) {
-			encodeInt64(e, kindTimestamp, name, fs, value)
+			encodeInt64(e, KindTimestamp, name, fs, value)
 		},
 	}
 }
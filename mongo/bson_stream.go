@@ -0,0 +1,142 @@
+// Copyright 2011 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package mongo
+
+import (
+	"errors"
+	"io"
+	"strconv"
+)
+
+// DefaultMaxDocumentSize is the default maximum size of a document read or
+// written by a stream Encoder or Decoder. The value matches the MongoDB
+// server limit and is used by connections when the server does not report a
+// limit.
+const DefaultMaxDocumentSize = 16 * 1024 * 1024
+
+func documentSizeError(n, max int) error {
+	return errors.New("bson: document size " + strconv.Itoa(n) + " exceeds maximum " + strconv.Itoa(max))
+}
+
+// Encoder writes a stream of BSON documents to an output stream. The format
+// of the stream is the same as the format of the files written by mongodump.
+type Encoder struct {
+	w       io.Writer
+	buf     []byte
+	max     int
+	options *EncodeOptions
+}
+
+// NewEncoder returns a new encoder that writes to w.
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w: w, max: DefaultMaxDocumentSize}
+}
+
+// SetMaxDocumentSize sets the maximum size of an encoded document.
+func (enc *Encoder) SetMaxDocumentSize(n int) {
+	enc.max = n
+}
+
+// SetOptions sets the options used to encode documents.
+func (enc *Encoder) SetOptions(options *EncodeOptions) {
+	enc.options = options
+}
+
+// Encode writes the BSON encoding of doc to the stream. See the Encode
+// function for more information about BSON encoding.
+func (enc *Encoder) Encode(doc interface{}) error {
+	buf, err := EncodeWithOptions(enc.buf[:0], doc, enc.options)
+	if err != nil {
+		return err
+	}
+	enc.buf = buf
+	if len(buf) > enc.max {
+		return documentSizeError(len(buf), enc.max)
+	}
+	_, err = enc.w.Write(buf)
+	return err
+}
+
+// Decoder reads a stream of BSON documents from an input stream.
+type Decoder struct {
+	r       io.Reader
+	buf     []byte
+	max     int
+	options *DecodeOptions
+}
+
+// NewDecoder returns a new decoder that reads from r. The decoder does not
+// read past the end of the last document returned.
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{r: r, max: DefaultMaxDocumentSize}
+}
+
+// SetMaxDocumentSize sets the maximum size of a document read from the
+// stream.
+func (dec *Decoder) SetMaxDocumentSize(n int) {
+	dec.max = n
+}
+
+// SetOptions sets the options used to decode documents.
+func (dec *Decoder) SetOptions(options *DecodeOptions) {
+	dec.options = options
+}
+
+// DecodeRaw reads the next document from the stream. The returned document
+// is valid until the next call to a method on the decoder. DecodeRaw returns
+// io.EOF at the end of the stream and io.ErrUnexpectedEOF if the stream ends
+// inside a document.
+func (dec *Decoder) DecodeRaw() (Raw, error) {
+	if cap(dec.buf) < 4 {
+		dec.buf = make([]byte, 4, 512)
+	}
+	if _, err := io.ReadFull(dec.r, dec.buf[:4]); err != nil {
+		return nil, err
+	}
+	n := int(int32(wire.Uint32(dec.buf)))
+	if n < 5 {
+		return nil, errors.New("bson: invalid document length " + strconv.Itoa(n))
+	}
+	if n > dec.max {
+		return nil, documentSizeError(n, dec.max)
+	}
+	if n > cap(dec.buf) {
+		buf := make([]byte, n)
+		copy(buf, dec.buf[:4])
+		dec.buf = buf
+	}
+	p := dec.buf[:n]
+	if _, err := io.ReadFull(dec.r, p[4:]); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	if p[n-1] != 0 {
+		return nil, errors.New("bson: document not null terminated")
+	}
+	return Raw(p), nil
+}
+
+// Decode reads the next document from the stream and decodes it to v. See
+// the Decode function for more information about BSON decoding. Decode
+// returns io.EOF at the end of the stream.
+func (dec *Decoder) Decode(v interface{}) error {
+	p, err := dec.DecodeRaw()
+	if err != nil {
+		return err
+	}
+	return DecodeWithOptions(p, v, dec.options)
+}
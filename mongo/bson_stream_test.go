@@ -0,0 +1,83 @@
+// Copyright 2011 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package mongo
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestEncoderDecoder(t *testing.T) {
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf)
+	docs := []M{{"a": 1}, {"b": strings.Repeat("x", 1000)}, {}}
+	for _, doc := range docs {
+		if err := enc.Encode(doc); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dec := NewDecoder(&buf)
+	for _, doc := range docs {
+		var m M
+		if err := dec.Decode(&m); err != nil {
+			t.Fatal(err)
+		}
+		if len(m) != len(doc) {
+			t.Errorf("decoded %v, want %v", m, doc)
+		}
+	}
+	if err := dec.Decode(&M{}); err != io.EOF {
+		t.Errorf("Decode at end of stream returned %v, want io.EOF", err)
+	}
+}
+
+func TestDecoderErrors(t *testing.T) {
+	doc, _ := Encode(nil, M{"a": "hello"})
+	for _, tt := range []struct {
+		data string
+		err  error
+	}{
+		{string(doc[:2]), io.ErrUnexpectedEOF},
+		{string(doc[:len(doc)-1]), io.ErrUnexpectedEOF},
+		{"\x04\x00\x00\x00", nil},
+		{"\xff\xff\xff\xff", nil},
+		{"\x05\x00\x00\x00\x01", nil},
+		{"\x00\x00\x00\x01", nil},
+	} {
+		_, err := NewDecoder(strings.NewReader(tt.data)).DecodeRaw()
+		if err == nil || err == io.EOF || (tt.err != nil && err != tt.err) {
+			t.Errorf("DecodeRaw(%q) returned %v, want %v", tt.data, err, tt.err)
+		}
+	}
+
+	dec := NewDecoder(bytes.NewReader(doc))
+	dec.SetMaxDocumentSize(len(doc) - 1)
+	if _, err := dec.DecodeRaw(); err == nil {
+		t.Error("DecodeRaw of oversized document did not return error")
+	}
+
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf)
+	enc.SetMaxDocumentSize(len(doc) - 1)
+	if err := enc.Encode(M{"a": "hello"}); err == nil {
+		t.Error("Encode of oversized document did not return error")
+	}
+	if buf.Len() != 0 {
+		t.Errorf("Encode of oversized document wrote %d bytes", buf.Len())
+	}
+}
@@ -16,6 +16,7 @@ package mongo
 
 import (
 	"bytes"
+	"errors"
 	"math"
 	"reflect"
 	"testing"
@@ -53,6 +54,14 @@ type stBinary struct {
 	Test []byte `bson:"test,omitempty"`
 }
 
+type stBinaryType struct {
+	Test Binary `bson:"test,omitempty"`
+}
+
+type stUUID struct {
+	Test UUID `bson:"test,omitempty"`
+}
+
 type myBytes []byte
 
 type stMyBytes struct {
@@ -75,6 +84,18 @@ type stRegexp struct {
 	Test Regexp `bson:"test,omitempty"`
 }
 
+type stCode struct {
+	Test Code `bson:"test,omitempty"`
+}
+
+type stUndefined struct {
+	Test Undefined `bson:"test"`
+}
+
+type stDBPointer struct {
+	Test DBPointer `bson:"test,omitempty"`
+}
+
 type stSymbol struct {
 	Test Symbol `bson:"test,omitempty"`
 }
@@ -127,6 +148,10 @@ type stTimestamp struct {
 	Test Timestamp `bson:"test,omitempty"`
 }
 
+type stDecimal128 struct {
+	Test Decimal128 `bson:"test,omitempty"`
+}
+
 type stMinMax struct {
 	Test MinMax `bson:"test,omitempty"`
 }
@@ -176,6 +201,8 @@ var bsonTests = []struct {
 	{stAny{}, empty, empty, "\x05\x00\x00\x00\x00"},
 	{stDoc{}, empty, empty, "\x05\x00\x00\x00\x00"},
 	{stBinary{}, empty, empty, "\x05\x00\x00\x00\x00"},
+	{stBinaryType{}, empty, empty, "\x05\x00\x00\x00\x00"},
+	{stUUID{}, empty, empty, "\x05\x00\x00\x00\x00"},
 	{stMyBytes{}, empty, empty, "\x05\x00\x00\x00\x00"},
 	{stObjectId{}, empty, empty, "\x05\x00\x00\x00\x00"},
 	{stBool{}, empty, empty, "\x05\x00\x00\x00\x00"},
@@ -193,9 +220,12 @@ var bsonTests = []struct {
 	{stUint{}, empty, empty, "\x05\x00\x00\x00\x00"},
 	{stMinMax{}, empty, empty, "\x05\x00\x00\x00\x00"},
 	{stCodeWithScope{}, empty, empty, "\x05\x00\x00\x00\x00"},
+	{stCode{}, empty, empty, "\x05\x00\x00\x00\x00"},
+	{stDBPointer{}, empty, empty, "\x05\x00\x00\x00\x00"},
 	{stRegexp{}, empty, empty, "\x05\x00\x00\x00\x00"},
 	{stTimestamp{}, empty, empty, "\x05\x00\x00\x00\x00"},
 	{stTime{}, empty, empty, "\x05\x00\x00\x00\x00"},
+	{stDecimal128{}, empty, empty, "\x05\x00\x00\x00\x00"},
 
 	{
 		stEmpty{},
@@ -245,6 +275,24 @@ var bsonTests = []struct {
 		testMap([]byte("test")),
 		"\x14\x00\x00\x00\x05\x74\x65\x73\x74\x00\x04\x00\x00\x00\x00\x74\x65\x73\x74\x00",
 	},
+	{
+		stBinaryType{Binary{BinaryUserDefined, []byte("test")}},
+		testMap(Binary{BinaryUserDefined, []byte("test")}),
+		testMap(Binary{BinaryUserDefined, []byte("test")}),
+		"\x14\x00\x00\x00\x05test\x00\x04\x00\x00\x00\x80test\x00",
+	},
+	{
+		stBinaryType{Binary{BinaryOld, []byte("test")}},
+		testMap(Binary{BinaryOld, []byte("test")}),
+		testMap([]byte("test")),
+		"\x18\x00\x00\x00\x05test\x00\x08\x00\x00\x00\x02\x04\x00\x00\x00test\x00",
+	},
+	{
+		stUUID{UUID{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}},
+		testMap(UUID{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}),
+		testMap(UUID{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}),
+		"\x20\x00\x00\x00\x05test\x00\x10\x00\x00\x00\x04\x00\x01\x02\x03\x04\x05\x06\x07\x08\x09\x0a\x0b\x0c\x0d\x0e\x0f\x00",
+	},
 	{
 		stMyBytes{myBytes([]byte("test"))},
 		testMap(myBytes([]byte("test"))),
@@ -366,13 +414,48 @@ var bsonTests = []struct {
 		"\x0B\x00\x00\x00\xFFtest\x00\x00",
 	},
 
+	{
+		stDecimal128{NewDecimal128(0x3040000000000000, 1)},
+		testMap(NewDecimal128(0x3040000000000000, 1)),
+		testMap(NewDecimal128(0x3040000000000000, 1)),
+		"\x1b\x00\x00\x00\x13test\x00\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x40\x30\x00",
+	},
+
 	{
 		stRegexp{Regexp{"a*b", "i"}},
 		testMap(Regexp{"a*b", "i"}),
-		nil,
+		testMap(Regexp{"a*b", "i"}),
 		"\x11\x00\x00\x00\vtest\x00a*b\x00i\x00\x00",
 	},
 
+	{
+		stCode{Code("test")},
+		testMap(Code("test")),
+		testMap(Code("test")),
+		"\x14\x00\x00\x00\x0dtest\x00\x05\x00\x00\x00test\x00\x00",
+	},
+
+	{
+		stCodeWithScope{CodeWithScope{"test", map[string]interface{}{"x": 1}}},
+		testMap(CodeWithScope{"test", map[string]interface{}{"x": 1}}),
+		testMap(CodeWithScope{"test", map[string]interface{}{"x": 1}}),
+		"\x24\x00\x00\x00\x0ftest\x00\x19\x00\x00\x00\x05\x00\x00\x00test\x00\x0c\x00\x00\x00\x10x\x00\x01\x00\x00\x00\x00\x00",
+	},
+
+	{
+		stUndefined{},
+		testMap(Undefined{}),
+		testMap(Undefined{}),
+		"\x0b\x00\x00\x00\x06test\x00\x00",
+	},
+
+	{
+		stDBPointer{DBPointer{"db.c", ObjectId("\x01\x02\x03\x04\x05\x06\x07\x08\x09\x0a\x0b\x0c")}},
+		testMap(DBPointer{"db.c", ObjectId("\x01\x02\x03\x04\x05\x06\x07\x08\x09\x0a\x0b\x0c")}),
+		testMap(DBPointer{"db.c", ObjectId("\x01\x02\x03\x04\x05\x06\x07\x08\x09\x0a\x0b\x0c")}),
+		"\x20\x00\x00\x00\x0ctest\x00\x05\x00\x00\x00db.c\x00\x01\x02\x03\x04\x05\x06\x07\x08\x09\x0a\x0b\x0c\x00",
+	},
+
 	{
 		stCodeWithScope{CodeWithScope{"test", nil}},
 		testMap(CodeWithScope{"test", nil}),
@@ -436,7 +519,7 @@ var bsonTests = []struct {
 		"\x2a\x00\x00\x00\x04test\x00\x1f\x00\x00\x00\x020\x00\x06\x00\x00\x00hello\x00\x021\x00\x06\x00\x00\x00world\x00\x00\x00",
 	},
 
-	{BSONData{Kind: kindDocument, Data: []byte("\x15\x00\x00\x00\x02test\x00\x06\x00\x00\x00world\x00\x00")},
+	{BSONData{Kind: KindDocument, Data: []byte("\x15\x00\x00\x00\x02test\x00\x06\x00\x00\x00world\x00\x00")},
 		testMap("world"),
 		testMap("world"),
 		"\x15\x00\x00\x00\x02test\x00\x06\x00\x00\x00world\x00\x00",
@@ -616,6 +699,69 @@ func TestEncodeOrderedMap(t *testing.T) {
 	}
 }
 
+func TestDecodeOrdered(t *testing.T) {
+	doc := D{
+		{"z", int32(1)},
+		{"a", D{{"y", "b"}, {"x", A{int64(2), D{{"w", nil}, {"v", 1.5}}}}}},
+		{"n", BSONData{Kind: KindNull}},
+		{"old", Binary{BinaryOld, []byte{1}}},
+	}
+	data, err := Encode(nil, doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var v interface{}
+	if err := DecodeWithOptions(data, &v, &DecodeOptions{Ordered: true}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := v.(D); !ok {
+		t.Fatalf("decoded %T, want D", v)
+	}
+	actual, err := Encode(nil, v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(actual, data) {
+		t.Errorf("round trip with interface{} target = %q, want %q", actual, data)
+	}
+
+	var d D
+	if err := Decode(data, &d); err != nil {
+		t.Fatal(err)
+	}
+	if len(d) != 4 || d[0].Key != "z" || d[1].Key != "a" {
+		t.Errorf("decoded %v", d)
+	}
+	if nested, ok := d[1].Value.(D); !ok || nested[1].Key != "x" {
+		t.Errorf("nested document decoded as %T", d[1].Value)
+	} else if _, ok := nested[1].Value.(A); !ok {
+		t.Errorf("nested array decoded as %T", nested[1].Value)
+	}
+	actual, err = Encode(nil, d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(actual, data) {
+		t.Errorf("round trip with D target = %q, want %q", actual, data)
+	}
+
+	var s struct {
+		A D                      `bson:"a"`
+		M map[string]interface{} `bson:"m"`
+	}
+	data, _ = Encode(nil, D{{"a", D{{"b", 1}, {"a", 2}}}, {"m", D{{"c", D{}}}}})
+	if err := Decode(data, &s); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.A) != 2 || s.A[0].Key != "b" {
+		t.Errorf("struct field decoded as %v", s.A)
+	}
+	if _, ok := s.M["c"].(map[string]interface{}); !ok {
+		t.Errorf("map value decoded as %T, want map", s.M["c"])
+	}
+}
+
 func TestObjectId(t *testing.T) {
 	t1 := time.Now()
 	min := MinObjectIdForTime(t1)
@@ -643,6 +789,70 @@ func TestObjectId(t *testing.T) {
 	}
 }
 
+func TestNewObjectId(t *testing.T) {
+	id1 := NewObjectId()
+	id2 := NewObjectId()
+	if !id1.IsValid() || id1.IsZero() {
+		t.Fatalf("NewObjectId() = %q, want valid id", id1)
+	}
+	if id1[4:9] != id2[4:9] {
+		t.Errorf("process unique values %x and %x differ", id1[4:9], id2[4:9])
+	}
+	c1 := int(id1[9])<<16 | int(id1[10])<<8 | int(id1[11])
+	c2 := int(id2[9])<<16 | int(id2[10])<<8 | int(id2[11])
+	if (c1+1)&0xffffff != c2 {
+		t.Errorf("counters %x, %x not sequential", c1, c2)
+	}
+	if d := time.Since(id1.Timestamp()); d < 0 || d > time.Minute {
+		t.Errorf("Timestamp() = %v, want now", id1.Timestamp())
+	}
+	if id1.Hex() != id1.String() || len(id1.Hex()) != 24 {
+		t.Errorf("Hex() = %q", id1.Hex())
+	}
+	if NilObjectId.IsValid() || !NilObjectId.IsZero() || !ObjectId(make([]byte, 12)).IsZero() {
+		t.Error("NilObjectId is valid or not zero")
+	}
+}
+
+func TestObjectIdMarshal(t *testing.T) {
+	id, _ := NewObjectIdHex("4c9b8fb4a382aafe17c86e63")
+
+	text, _ := id.MarshalText()
+	var id2 ObjectId
+	if err := id2.UnmarshalText(text); err != nil || id2 != id || string(text) != id.Hex() {
+		t.Errorf("text round trip = %q, %q, %v", text, id2, err)
+	}
+	if err := id2.UnmarshalText([]byte("xyz")); err == nil {
+		t.Error("UnmarshalText(xyz) did not return error")
+	}
+
+	data, _ := id.MarshalBinary()
+	id2 = ""
+	if err := id2.UnmarshalBinary(data); err != nil || id2 != id {
+		t.Errorf("binary round trip = %q, %v", id2, err)
+	}
+	if err := id2.UnmarshalBinary(data[1:]); err == nil {
+		t.Error("UnmarshalBinary of short data did not return error")
+	}
+
+	v, _ := id.Value()
+	for _, src := range []interface{}{v, []byte(id), string(id)} {
+		id2 = ""
+		if err := id2.Scan(src); err != nil || id2 != id {
+			t.Errorf("Scan(%q) = %q, %v", src, id2, err)
+		}
+	}
+	if err := id2.Scan(nil); err != nil || id2 != NilObjectId {
+		t.Errorf("Scan(nil) = %q, %v", id2, err)
+	}
+	if err := id2.Scan(1); err == nil {
+		t.Error("Scan(1) did not return error")
+	}
+	if v, _ := NilObjectId.Value(); v != nil {
+		t.Errorf("NilObjectId.Value() = %v, want nil", v)
+	}
+}
+
 func TestObjectIdMarshalJSON(t *testing.T) {
 	jsonId := "\"4c9b8fb4a382aafe17c86e63\""
 	id, _ := NewObjectIdHex(jsonId[1:25])
@@ -730,3 +940,653 @@ func TestStructFields(t *testing.T) {
 		}
 	}
 }
+
+type stInlineInner struct {
+	B int `bson:"b"`
+}
+
+type stInline struct {
+	A     int                    `bson:"a"`
+	Inner stInlineInner          `bson:",inline"`
+	Extra map[string]interface{} `bson:",inline"`
+}
+
+func TestInline(t *testing.T) {
+	v := stInline{A: 1, Inner: stInlineInner{B: 2}, Extra: map[string]interface{}{"c": "x"}}
+	data, err := Encode(nil, &v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, _ := Encode(nil, D{{"a", 1}, {"b", 2}, {"c", "x"}})
+	if !bytes.Equal(data, expected) {
+		t.Errorf("Encode(%+v) = %q, want %q", v, data, expected)
+	}
+
+	var v2 stInline
+	if err := Decode(expected, &v2); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(v2, v) {
+		t.Errorf("Decode() = %+v, want %+v", v2, v)
+	}
+
+	v.Extra["a"] = 3
+	if _, err := Encode(nil, &v); err == nil {
+		t.Error("Encode with conflicting inline map key did not return error")
+	}
+
+	if fields := StructFields(reflect.TypeOf(v)); fields != nil {
+		t.Errorf("StructFields() = %v, want nil", fields)
+	}
+}
+
+func TestInlineMapKeys(t *testing.T) {
+	id := ObjectId("\x01\x02\x03\x04\x05\x06\x07\x08\x09\x0a\x0b\x0c")
+	v := struct {
+		Name string           `bson:"name"`
+		Ids  map[ObjectId]int `bson:",inline"`
+	}{Name: "x", Ids: map[ObjectId]int{id: 1}}
+	data, err := Encode(nil, &v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, _ := Encode(nil, D{{"name", "x"}, {id.Hex(), 1}})
+	if !bytes.Equal(data, expected) {
+		t.Errorf("Encode(%+v) = %q, want %q", v, data, expected)
+	}
+	v.Ids = nil
+	if err := Decode(data, &v); err != nil {
+		t.Fatal(err)
+	}
+	if len(v.Ids) != 1 || v.Ids[id] != 1 {
+		t.Errorf("Decode() = %v, want %v: 1", v.Ids, id)
+	}
+
+	var n struct {
+		Counts map[int]string `bson:",inline"`
+	}
+	data, _ = Encode(nil, D{{"7", "a"}, {"x", "b"}, {"-2", "c"}})
+	if err := Decode(data, &n); err == nil {
+		t.Error("Decode of non-integer inline map key did not return error")
+	}
+	if !reflect.DeepEqual(n.Counts, map[int]string{7: "a", -2: "c"}) {
+		t.Errorf("Decode() = %v", n.Counts)
+	}
+}
+
+type stTagFlags struct {
+	Small  int64   `bson:"small,minsize"`
+	Big    int64   `bson:"big,minsize"`
+	USmall uint64  `bson:"usmall,minsize"`
+	Trunc  int     `bson:"trunc,truncate"`
+	S      int     `bson:"s,string"`
+	F      float64 `bson:"f,string,omitempty"`
+}
+
+func TestTagFlags(t *testing.T) {
+	v := stTagFlags{Small: 1, Big: 1 << 40, USmall: 2, S: -3, F: 1.5}
+	data, err := Encode(nil, &v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, _ := Encode(nil, D{{"small", int32(1)}, {"big", int64(1 << 40)}, {"usmall", int32(2)}, {"trunc", int32(0)}, {"s", "-3"}, {"f", "1.5"}})
+	if !bytes.Equal(data, expected) {
+		t.Errorf("Encode(%+v) = %q, want %q", v, data, expected)
+	}
+
+	var v2 stTagFlags
+	if err := Decode(data, &v2); err != nil {
+		t.Fatal(err)
+	}
+	if v2 != v {
+		t.Errorf("Decode() = %+v, want %+v", v2, v)
+	}
+
+	data, _ = Encode(nil, D{{"trunc", 2.7}, {"s", int32(4)}})
+	v2 = stTagFlags{}
+	if err := Decode(data, &v2); err != nil {
+		t.Fatal(err)
+	}
+	if v2.Trunc != 2 || v2.S != 4 {
+		t.Errorf("Decode() = %+v, want trunc 2, s 4", v2)
+	}
+
+	strict := &DecodeOptions{StrictPrecision: true}
+	data, _ = Encode(nil, D{{"small", 2.7}})
+	if err := Decode(data, &v2); err != nil || v2.Small != 2 {
+		t.Errorf("Decode of fractional double to int64 = %d, %v, want 2, nil", v2.Small, err)
+	}
+	if err := DecodeWithOptions(data, &v2, strict); err == nil {
+		t.Error("strict Decode of fractional double to int64 without truncate flag did not return error")
+	}
+	data, _ = Encode(nil, D{{"trunc", 2.7}})
+	if err := DecodeWithOptions(data, &v2, strict); err != nil || v2.Trunc != 2 {
+		t.Errorf("strict Decode of fractional double to truncate field = %d, %v, want 2, nil", v2.Trunc, err)
+	}
+	data, _ = Encode(nil, D{{"s", "abc"}})
+	if err := Decode(data, &v2); err == nil {
+		t.Error("Decode of invalid number string did not return error")
+	}
+}
+
+func TestStrictPrecision(t *testing.T) {
+	strict := &DecodeOptions{StrictPrecision: true}
+	data, _ := Encode(nil, M{"x": 2.5})
+
+	m := map[string]int{}
+	if err := Decode(data, m); err != nil || m["x"] != 2 {
+		t.Errorf("Decode to map = %v, %v, want x: 2", m, err)
+	}
+	if err := DecodeWithOptions(data, m, strict); err == nil {
+		t.Error("strict Decode to map did not return error")
+	}
+	var u struct {
+		X uint8 `bson:"x"`
+	}
+	if err := Decode(data, &u); err != nil || u.X != 2 {
+		t.Errorf("Decode to untagged field = %d, %v, want 2", u.X, err)
+	}
+	if err := DecodeWithOptions(data, &u, strict); err == nil {
+		t.Error("strict Decode to untagged field did not return error")
+	}
+	var p struct {
+		X *int `bson:"x,truncate"`
+	}
+	if err := DecodeWithOptions(data, &p, strict); err != nil || p.X == nil || *p.X != 2 {
+		t.Errorf("strict Decode to truncate pointer field returned %v", err)
+	}
+}
+
+func TestBadTagFlags(t *testing.T) {
+	for _, v := range []interface{}{
+		struct {
+			A int `bson:"a,bogus"`
+		}{},
+		struct {
+			A string `bson:"a,string"`
+		}{},
+		struct {
+			A int `bson:",inline"`
+		}{},
+		struct {
+			A string `bson:"a,minsize"`
+		}{},
+		struct {
+			A int32 `bson:"a,minsize"`
+		}{},
+		struct {
+			A []int `bson:"a,truncate"`
+		}{},
+		struct {
+			A float64 `bson:"a,truncate"`
+		}{},
+		struct {
+			A struct{ X int } `bson:"a,truncate"`
+		}{},
+		struct {
+			A Nullable[int32] `bson:"a,minsize"`
+		}{},
+		struct {
+			A Nullable[int] `bson:"a,string"`
+		}{},
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("StructFields(%T) did not panic", v)
+				}
+			}()
+			StructFields(reflect.TypeOf(v))
+		}()
+	}
+}
+
+type AuditInfo struct {
+	CreatedBy string `bson:"createdBy,omitempty"`
+}
+
+type RecursiveNode struct {
+	*RecursiveNode
+	Name string `bson:"name"`
+}
+
+type embeddedHidden struct {
+	Hidden string `bson:"hidden"`
+}
+
+type embeddedSecret struct {
+	Secret string `bson:"secret"`
+}
+
+type stEmbedPtr struct {
+	Id int `bson:"_id"`
+	*AuditInfo
+	*RecursiveNode
+	embeddedHidden
+	*embeddedSecret
+}
+
+func TestEmbeddedPointer(t *testing.T) {
+	v := stEmbedPtr{Id: 1, AuditInfo: &AuditInfo{CreatedBy: "bob"}}
+	data, err := Encode(nil, &v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, _ := Encode(nil, D{{"_id", 1}, {"createdBy", "bob"}})
+	if !bytes.Equal(data, expected) {
+		t.Errorf("Encode(%+v) = %q, want %q", v, data, expected)
+	}
+
+	var v2 stEmbedPtr
+	if err := Decode(data, &v2); err != nil {
+		t.Fatal(err)
+	}
+	if v2.AuditInfo == nil || v2.CreatedBy != "bob" {
+		t.Errorf("Decode() = %+v, want AuditInfo allocated", v2)
+	}
+
+	data, err = Encode(nil, stEmbedPtr{Id: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, _ = Encode(nil, D{{"_id", 2}})
+	if !bytes.Equal(data, expected) {
+		t.Errorf("Encode with nil embedded pointer = %q, want %q", data, expected)
+	}
+	v2 = stEmbedPtr{}
+	if err := Decode(data, &v2); err != nil {
+		t.Fatal(err)
+	}
+	if v2.AuditInfo != nil {
+		t.Errorf("Decode() allocated AuditInfo for absent fields")
+	}
+
+	data, _ = Encode(nil, D{{"name", "x"}})
+	var r RecursiveNode
+	if err := Decode(data, &r); err != nil {
+		t.Fatal(err)
+	}
+	if r.Name != "x" || r.RecursiveNode != nil {
+		t.Errorf("Decode() = %+v, want name x", r)
+	}
+	data, err = Encode(nil, RecursiveNode{RecursiveNode: &RecursiveNode{Name: "inner"}, Name: "outer"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, _ = Encode(nil, D{{"name", "outer"}})
+	if !bytes.Equal(data, expected) {
+		t.Errorf("Encode(recursive) = %q, want %q", data, expected)
+	}
+
+	// Fields of unexported embedded struct values are promoted. Unexported
+	// embedded struct pointers are ignored.
+	v = stEmbedPtr{Id: 3, embeddedHidden: embeddedHidden{"h"}, embeddedSecret: &embeddedSecret{"s"}}
+	data, err = Encode(nil, v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, _ = Encode(nil, D{{"_id", 3}, {"hidden", "h"}})
+	if !bytes.Equal(data, expected) {
+		t.Errorf("Encode with unexported embedded structs = %q, want %q", data, expected)
+	}
+	data, _ = Encode(nil, D{{"_id", 3}, {"hidden", "h"}, {"secret", "s"}})
+	v2 = stEmbedPtr{}
+	if err := Decode(data, &v2); err != nil {
+		t.Fatal(err)
+	}
+	if v2.Hidden != "h" || v2.embeddedSecret != nil {
+		t.Errorf("Decode() = %+v, want hidden h and nil embeddedSecret", v2)
+	}
+}
+
+type stStrictInner struct {
+	N int `bson:"n"`
+}
+
+type stStrict struct {
+	A     int                      `bson:"a"`
+	Inner stStrictInner            `bson:"inner"`
+	List  []stStrictInner          `bson:"list"`
+	Map   map[string]stStrictInner `bson:"map"`
+}
+
+func TestDecodeStrict(t *testing.T) {
+	data, _ := Encode(nil, D{
+		{"a", "x"},
+		{"inner", D{{"n", 1}, {"extra", true}}},
+		{"list", A{D{{"n", 2}}, D{{"n", "y"}}}},
+		{"map", D{{"k", D{{"n", 1.5}}}}},
+		{"unknown", 1},
+	})
+
+	var v stStrict
+	if err := Decode(data, &v); err == nil {
+		t.Error("non-strict Decode did not return error")
+	} else if _, ok := err.(*StrictDecodeError); ok {
+		t.Errorf("non-strict Decode returned %v", err)
+	}
+
+	v = stStrict{}
+	err := DecodeWithOptions(data, &v, &DecodeOptions{Strict: true, StrictPrecision: true})
+	serr, ok := err.(*StrictDecodeError)
+	if !ok {
+		t.Fatalf("strict Decode returned %v, want *StrictDecodeError", err)
+	}
+	var actual []string
+	for _, e := range serr.Errors {
+		typ := "<nil>"
+		if e.Type != nil {
+			typ = e.Type.String()
+		}
+		actual = append(actual, e.Path+" "+kindName(e.Kind)+" "+typ)
+	}
+	expected := []string{
+		"a string int",
+		"inner.extra bool <nil>",
+		"list.1.n string int",
+		"map.k.n float int",
+		"unknown int32 <nil>",
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("errors = %q, want %q", actual, expected)
+	}
+	if v.Inner.N != 1 || len(v.List) != 2 || v.List[0].N != 2 {
+		t.Errorf("decoded %+v, want matching fields set", v)
+	}
+
+	data, _ = Encode(nil, D{{"a", 1}})
+	if err := DecodeWithOptions(data, &v, &DecodeOptions{Strict: true}); err != nil {
+		t.Errorf("strict Decode of matching document returned %v", err)
+	}
+}
+
+func TestEncodeSortKeys(t *testing.T) {
+	m := M{"c": 1, "_id": 2, "a": M{"z": 1, "y": 2, "_id": 3}, "b": 4}
+	expected, _ := Encode(nil, D{{"_id", 2}, {"a", D{{"_id", 3}, {"y", 2}, {"z", 1}}}, {"b", 4}, {"c", 1}})
+	for i := 0; i < 10; i++ {
+		data, err := EncodeWithOptions(nil, m, &EncodeOptions{SortKeys: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data, expected) {
+			t.Fatalf("EncodeWithOptions(%v) = %q, want %q", m, data, expected)
+		}
+	}
+}
+
+func TestBufferPool(t *testing.T) {
+	for _, n := range []int{0, 1024, 1025, 1 << 20, 1 << 25} {
+		p := GetBuffer(n)
+		if len(p) != 0 || cap(p) < n {
+			t.Errorf("GetBuffer(%d) returned len %d, cap %d", n, len(p), cap(p))
+		}
+		PutBuffer(append(p, 1))
+	}
+	PutBuffer(nil)
+	PutBuffer(make([]byte, 10))
+}
+
+type benchmarkDoc struct {
+	Id      ObjectId  `bson:"_id"`
+	Name    string    `bson:"name"`
+	Count   int       `bson:"count"`
+	Score   float64   `bson:"score"`
+	Created time.Time `bson:"created"`
+	Tags    []string  `bson:"tags"`
+	Payload []byte    `bson:"payload"`
+}
+
+var benchmarkValue = benchmarkDoc{
+	Id:      ObjectId("\x01\x02\x03\x04\x05\x06\x07\x08\x09\x0a\x0b\x0c"),
+	Name:    "benchmark",
+	Count:   42,
+	Score:   1.5,
+	Created: time.Unix(1300000000, 0),
+	Tags:    []string{"a", "b", "c"},
+	Payload: bytes.Repeat([]byte{'x'}, 4096),
+}
+
+func BenchmarkEncode(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := Encode(nil, &benchmarkValue); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkEncodePooledBuffer(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		buf, err := Encode(GetBuffer(8192), &benchmarkValue)
+		if err != nil {
+			b.Fatal(err)
+		}
+		PutBuffer(buf)
+	}
+}
+
+func BenchmarkEncodeReuseBuffer(b *testing.B) {
+	b.ReportAllocs()
+	var buf []byte
+	for i := 0; i < b.N; i++ {
+		var err error
+		buf, err = Encode(buf[:0], &benchmarkValue)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDecode(b *testing.B) {
+	data, _ := Encode(nil, &benchmarkValue)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		var v benchmarkDoc
+		if err := Decode(data, &v); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+type colorKey int
+
+func (c colorKey) MarshalText() ([]byte, error) {
+	switch c {
+	case 0:
+		return []byte("red"), nil
+	case 1:
+		return []byte("green"), nil
+	}
+	return nil, errors.New("bad color")
+}
+
+func (c *colorKey) UnmarshalText(p []byte) error {
+	switch string(p) {
+	case "red":
+		*c = 0
+	case "green":
+		*c = 1
+	default:
+		return errors.New("bad color")
+	}
+	return nil
+}
+
+type keyName string
+
+func TestMapKeys(t *testing.T) {
+	oid, _ := NewObjectIdHex("4c9b8fb4a382aafe17c86e63")
+	tests := []struct {
+		m        interface{}
+		expected D
+	}{
+		{map[int64]int{-2: 1, 10: 2}, D{{"-2", 1}, {"10", 2}}},
+		{map[uint8]int{7: 1}, D{{"7", 1}}},
+		{map[colorKey]int{0: 1, 1: 2}, D{{"green", 2}, {"red", 1}}},
+		{map[keyName]int{"x": 1, "_id": 2}, D{{"_id", 2}, {"x", 1}}},
+		{map[ObjectId]int{oid: 1}, D{{"4c9b8fb4a382aafe17c86e63", 1}}},
+	}
+	for _, tt := range tests {
+		data, err := EncodeWithOptions(nil, tt.m, &EncodeOptions{SortKeys: true})
+		if err != nil {
+			t.Errorf("Encode(%v) returned %v", tt.m, err)
+			continue
+		}
+		expected, _ := Encode(nil, tt.expected)
+		if !bytes.Equal(data, expected) {
+			t.Errorf("Encode(%v) = %q, want %q", tt.m, data, expected)
+		}
+		v := reflect.New(reflect.TypeOf(tt.m))
+		if err := Decode(data, v.Interface()); err != nil {
+			t.Errorf("Decode(%v) returned %v", tt.m, err)
+			continue
+		}
+		if !reflect.DeepEqual(v.Elem().Interface(), tt.m) {
+			t.Errorf("Decode() = %v, want %v", v.Elem().Interface(), tt.m)
+		}
+	}
+
+	if _, err := Encode(nil, map[colorKey]int{2: 1}); err == nil {
+		t.Error("Encode with failing MarshalText did not return error")
+	}
+	if _, err := Encode(nil, map[float64]int{1: 1}); err == nil {
+		t.Error("Encode with float key did not return error")
+	}
+	data, _ := Encode(nil, D{{"1", 1}, {"x", 2}, {"300", 3}})
+	var m map[uint8]int
+	if err := Decode(data, &m); err == nil {
+		t.Error("Decode with bad integer keys did not return error")
+	}
+	if m[1] != 1 || len(m) != 1 {
+		t.Errorf("Decode with bad integer keys = %v, want valid keys decoded", m)
+	}
+}
+
+type durationDoc struct {
+	D   time.Duration `bson:"d"`
+	Ms  time.Duration `bson:"ms,millis"`
+	S   time.Duration `bson:"s,seconds"`
+	Str time.Duration `bson:"str,string"`
+	T   time.Duration `bson:"t,seconds,truncate"`
+}
+
+func TestDuration(t *testing.T) {
+	v := durationDoc{D: 5, Ms: 1500 * time.Millisecond, S: 2 * time.Minute, Str: 90 * time.Minute, T: 2500 * time.Millisecond}
+	data, err := Encode(nil, &v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, _ := Encode(nil, D{{"d", int64(5)}, {"ms", int64(1500)}, {"s", int64(120)}, {"str", "1h30m0s"}, {"t", int64(2)}})
+	if !bytes.Equal(data, expected) {
+		t.Errorf("Encode(%+v) = %q, want %q", v, data, expected)
+	}
+
+	var v2 durationDoc
+	if err := Decode(data, &v2); err != nil {
+		t.Fatal(err)
+	}
+	v.T = 2 * time.Second
+	if v2 != v {
+		t.Errorf("Decode() = %+v, want %+v", v2, v)
+	}
+
+	data, _ = Encode(nil, M{"ms": 1.5, "s": int32(3)})
+	if err := Decode(data, &v2); err != nil {
+		t.Fatal(err)
+	}
+	if v2.Ms != 1500*time.Microsecond || v2.S != 3*time.Second {
+		t.Errorf("Decode() = %+v", v2)
+	}
+
+	data, _ = Encode(nil, M{"s": int64(math.MaxInt64 / 10)})
+	if err := Decode(data, &v2); err == nil {
+		t.Error("Decode of overflowing duration did not return error")
+	}
+
+	data, _ = Encode(nil, M{"ms": 1.0000005, "t": 1.0000000001})
+	v2 = durationDoc{}
+	if err := Decode(data, &v2); err != nil || v2.Ms != 1000000 || v2.T != time.Second {
+		t.Errorf("Decode of fractional nanoseconds = %+v, %v", v2, err)
+	}
+	if err := DecodeWithOptions(data, &v2, &DecodeOptions{StrictPrecision: true}); err == nil {
+		t.Error("strict Decode of fractional nanoseconds did not return error")
+	}
+	data, _ = Encode(nil, M{"t": 1.0000000001})
+	if err := DecodeWithOptions(data, &v2, &DecodeOptions{StrictPrecision: true}); err != nil {
+		t.Errorf("strict Decode of truncate field returned %v", err)
+	}
+	data, _ = Encode(nil, M{"s": 1.005, "ms": 0.1, "t": -1.5})
+	v2 = durationDoc{}
+	if err := DecodeWithOptions(data, &v2, &DecodeOptions{StrictPrecision: true}); err != nil ||
+		v2.S != 1005*time.Millisecond || v2.Ms != 100*time.Microsecond || v2.T != -1500*time.Millisecond {
+		t.Errorf("strict Decode of decimal fractions = %+v, %v", v2, err)
+	}
+	data, _ = Encode(nil, M{"s": -1.0000000015})
+	if err := Decode(data, &v2); err != nil || v2.S != -time.Second-time.Nanosecond {
+		t.Errorf("Decode of negative fractional nanoseconds = %+v, %v", v2, err)
+	}
+	data, _ = Encode(nil, M{"ms": BSONData{Kind: KindNull}, "str": BSONData{Kind: KindNull}})
+	v2 = durationDoc{Ms: 1, Str: 1}
+	if err := DecodeWithOptions(data, &v2, &DecodeOptions{PreserveNulls: true}); err != nil || v2.Ms != 0 || v2.Str != 0 {
+		t.Errorf("Decode of null durations with PreserveNulls = %+v, %v", v2, err)
+	}
+	for _, f := range []float64{1e300, math.Inf(1), math.NaN()} {
+		data, _ = Encode(nil, M{"ms": f})
+		if err := Decode(data, &v2); err == nil {
+			t.Errorf("Decode of %v milliseconds did not return error", f)
+		}
+	}
+
+	options := &EncodeOptions{StrictPrecision: true}
+	if _, err := EncodeWithOptions(nil, &durationDoc{Ms: time.Microsecond}, options); err == nil {
+		t.Error("strict Encode of sub-millisecond duration did not return error")
+	}
+	if _, err := EncodeWithOptions(nil, &durationDoc{T: time.Millisecond}, options); err != nil {
+		t.Errorf("strict Encode of truncate field returned %v", err)
+	}
+}
+
+func TestTimeOptions(t *testing.T) {
+	tm := time.Date(2011, 3, 4, 5, 6, 7, 8e6, time.UTC)
+	data, _ := Encode(nil, M{"t": tm})
+
+	loc := time.FixedZone("X", 3600)
+	var v struct {
+		T time.Time `bson:"t"`
+	}
+	if err := DecodeWithOptions(data, &v, &DecodeOptions{Location: loc}); err != nil {
+		t.Fatal(err)
+	}
+	if v.T.Location() != loc || !v.T.Equal(tm) {
+		t.Errorf("Decode() with Location = %v, want %v in %v", v.T, tm, loc)
+	}
+	m := M{}
+	if err := DecodeWithOptions(data, m, &DecodeOptions{Location: loc}); err != nil {
+		t.Fatal(err)
+	}
+	if mt, _ := m["t"].(time.Time); mt.Location() != loc {
+		t.Errorf("Decode() to map with Location = %v", m["t"])
+	}
+	if err := Decode(data, &v); err != nil || v.T.Location() != time.UTC {
+		t.Errorf("Decode() = %v, %v, want UTC", v.T, err)
+	}
+
+	options := &EncodeOptions{StrictPrecision: true}
+	if _, err := EncodeWithOptions(nil, M{"t": tm}, options); err != nil {
+		t.Errorf("strict Encode of millisecond time returned %v", err)
+	}
+	if _, err := EncodeWithOptions(nil, M{"t": tm.Add(1)}, options); err == nil {
+		t.Error("strict Encode of sub-millisecond time did not return error")
+	}
+	var s struct {
+		T time.Time `bson:"t,truncate"`
+	}
+	s.T = tm.Add(1)
+	if _, err := EncodeWithOptions(nil, &s, options); err != nil {
+		t.Errorf("strict Encode of truncate field returned %v", err)
+	}
+	if _, err := Encode(nil, M{"t": tm.Add(1)}); err != nil {
+		t.Errorf("Encode of sub-millisecond time returned %v", err)
+	}
+}
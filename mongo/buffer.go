@@ -16,6 +16,7 @@ package mongo
 
 import (
 	"encoding/binary"
+	"sync"
 )
 
 var wire = binary.LittleEndian
@@ -56,3 +57,65 @@ func (b *buffer) WriteUint32(n uint32) {
 func (b *buffer) WriteUint64(n uint64) {
 	wire.PutUint64(b.Next(8), n)
 }
+
+// The buffer pool has size classes from 1 KiB to 16 MiB in powers of four.
+// Buffers more than twice the size of the largest class are not pooled.
+const (
+	minBufferClassShift = 10
+	bufferClassShift    = 2
+	numBufferClasses    = 8
+)
+
+// pooledBuffer holds a buffer in a sync.Pool. The holders are recycled so
+// that putting a buffer in the pool does not allocate.
+type pooledBuffer struct {
+	p []byte
+}
+
+var (
+	bufferPools [numBufferClasses]sync.Pool
+	holderPool  = sync.Pool{New: func() interface{} { return new(pooledBuffer) }}
+)
+
+func bufferClassSize(class int) int {
+	return 1 << (minBufferClassShift + bufferClassShift*class)
+}
+
+// GetBuffer returns an empty buffer with capacity of at least n bytes from a
+// pool of buffers. Pass the buffer to Encode or EncodeWithOptions to encode
+// documents without allocating and return the buffer to the pool with
+// PutBuffer when done.
+func GetBuffer(n int) []byte {
+	for class := 0; class < numBufferClasses; class++ {
+		size := bufferClassSize(class)
+		if n > size {
+			continue
+		}
+		if h, ok := bufferPools[class].Get().(*pooledBuffer); ok {
+			p := h.p
+			h.p = nil
+			holderPool.Put(h)
+			return p[:0]
+		}
+		return make([]byte, 0, size)
+	}
+	return make([]byte, 0, n)
+}
+
+// PutBuffer returns a buffer to the pool used by GetBuffer. The buffer does not
+// need to be obtained from GetBuffer. The caller must not use the buffer after
+// calling PutBuffer.
+func PutBuffer(p []byte) {
+	class := numBufferClasses - 1
+	for ; class >= 0; class-- {
+		if cap(p) >= bufferClassSize(class) {
+			break
+		}
+	}
+	if class < 0 || cap(p) > 2*bufferClassSize(numBufferClasses-1) {
+		return
+	}
+	h := holderPool.Get().(*pooledBuffer)
+	h.p = p[:0]
+	bufferPools[class].Put(h)
+}
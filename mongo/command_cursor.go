@@ -0,0 +1,339 @@
+// Copyright 2011 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package mongo
+
+import (
+	"errors"
+	"time"
+)
+
+// CommandCursorOptions specifies options for cursors returned by commands.
+type CommandCursorOptions struct {
+	// Sets the number of documents requested by each getMore command. If
+	// zero, then the server default is used.
+	BatchSize int
+
+	// Maximum time that the server waits for new documents before returning
+	// an empty batch to a getMore command on a tailable await cursor.
+	MaxAwaitTime time.Duration
+
+	// If true, then an empty batch from the server ends the current
+	// iteration of the cursor without closing the cursor. See the Cursor
+	// documentation for more information about tailable cursors.
+	Tailable bool
+}
+
+// CommandCursor is a cursor over the results of a command that returns a
+// cursor document. Examples of these commands are find, aggregate,
+// listCollections and listIndexes.
+//
+// Command cursors use the getMore and killCursors commands to fetch
+// additional batches and release the cursor on the server.
+type CommandCursor struct {
+	conn        Conn
+	dbname      string
+	collection  string
+	id          int64
+	batch       []BSONData
+	resumeToken BSONData
+	options     CommandCursorOptions
+	findOptions *FindOptions
+	err         error
+}
+
+// cursorReply is the reply to a command that returns a cursor document.
+type cursorReply struct {
+	CommandResponse
+	Cursor struct {
+		Id                   int64      `bson:"id"`
+		Namespace            string     `bson:"ns"`
+		FirstBatch           []BSONData `bson:"firstBatch"`
+		NextBatch            []BSONData `bson:"nextBatch"`
+		PostBatchResumeToken BSONData   `bson:"postBatchResumeToken"`
+	} `bson:"cursor"`
+}
+
+// newCommandCursor runs cmd on database dbname and returns a cursor over the
+// cursor document in the reply.
+func newCommandCursor(conn Conn, dbname string, cmd interface{}, findOptions *FindOptions, options *CommandCursorOptions) (*CommandCursor, error) {
+	r := &CommandCursor{
+		conn:        conn,
+		dbname:      dbname,
+		findOptions: findOptions,
+	}
+	if options != nil {
+		r.options = *options
+	}
+	var reply cursorReply
+	if err := runInternal(conn, dbname, cmd, findOptions, &reply); err != nil {
+		return nil, err
+	}
+	if err := reply.Err(); err != nil {
+		return nil, err
+	}
+	if reply.Cursor.Namespace == "" && reply.Cursor.Id != 0 {
+		return nil, errors.New("mongo: command reply does not contain cursor namespace")
+	}
+	_, r.collection = SplitNamespace(reply.Cursor.Namespace)
+	r.id = reply.Cursor.Id
+	r.batch = reply.Cursor.FirstBatch
+	r.resumeToken = reply.Cursor.PostBatchResumeToken
+	return r, nil
+}
+
+// RunCursor runs a command that returns a cursor document, for example the
+// aggregate or listCollections commands, and returns a cursor over the
+// result.
+func (db Database) RunCursor(cmd interface{}, options *CommandCursorOptions) (*CommandCursor, error) {
+	return newCommandCursor(db.Conn, db.Name, cmd, runFindOptions, options)
+}
+
+// ListCollections returns a cursor over documents describing the collections
+// in the database. If filter is not nil, then only the collections matching
+// the filter are returned.
+//
+// More information: http://docs.mongodb.org/manual/reference/command/listCollections/
+func (db Database) ListCollections(filter interface{}) (*CommandCursor, error) {
+	cmd := D{{"listCollections", 1}}
+	if filter != nil {
+		cmd.Append("filter", filter)
+	}
+	return db.RunCursor(cmd, nil)
+}
+
+// ListIndexes returns a cursor over the index specifications for the
+// collection.
+//
+// More information: http://docs.mongodb.org/manual/reference/command/listIndexes/
+func (c Collection) ListIndexes() (*CommandCursor, error) {
+	return c.Db().RunCursor(D{{"listIndexes", c.Name()}}, nil)
+}
+
+// Aggregate runs the aggregation pipeline on the collection and returns a
+// cursor over the result. The pipeline is an array of stage documents.
+//
+// More information: http://docs.mongodb.org/manual/reference/command/aggregate/
+func (c Collection) Aggregate(pipeline interface{}, options *CommandCursorOptions) (*CommandCursor, error) {
+	cursor := D{}
+	if options != nil && options.BatchSize != 0 {
+		cursor.Append("batchSize", options.BatchSize)
+	}
+	cmd := D{{"aggregate", c.Name()}, {"pipeline", pipeline}, {"cursor", cursor}}
+	return c.Db().RunCursor(cmd, options)
+}
+
+// CommandCursor executes the query using the find command and returns a
+// cursor over the results. Subsequent changes to the query object are ignored
+// by the cursor.
+//
+// More information: http://docs.mongodb.org/manual/reference/command/find/
+func (q *Query) CommandCursor() (*CommandCursor, error) {
+	dbname, cname := SplitNamespace(q.Namespace)
+	cmd := D{{"find", cname}}
+	if q.Spec.Query != nil {
+		cmd.Append("filter", q.Spec.Query)
+	}
+	if q.Spec.Sort != nil {
+		cmd.Append("sort", q.Spec.Sort)
+	}
+	if q.Options.Fields != nil {
+		cmd.Append("projection", q.Options.Fields)
+	}
+	if q.Spec.Hint != nil {
+		cmd.Append("hint", q.Spec.Hint)
+	}
+	if q.Spec.Min != nil {
+		cmd.Append("min", q.Spec.Min)
+	}
+	if q.Spec.Max != nil {
+		cmd.Append("max", q.Spec.Max)
+	}
+	if q.Spec.Snapshot {
+		cmd.Append("snapshot", true)
+	}
+	if q.Options.Skip != 0 {
+		cmd.Append("skip", q.Options.Skip)
+	}
+
+	options := CommandCursorOptions{Tailable: q.Options.Tailable, MaxAwaitTime: q.Options.MaxAwaitTime}
+	batchSize := q.Options.BatchSize
+	singleBatch := false
+	if batchSize < 0 {
+		batchSize *= -1
+		singleBatch = true
+	}
+	limit := q.Options.Limit
+	if limit < 0 {
+		limit *= -1
+		singleBatch = true
+	}
+	if limit != 0 && !q.Options.Tailable {
+		cmd.Append("limit", limit)
+	}
+	if batchSize != 0 {
+		cmd.Append("batchSize", batchSize)
+		options.BatchSize = batchSize
+	}
+	if singleBatch {
+		cmd.Append("singleBatch", true)
+	}
+	if q.Options.Tailable {
+		cmd.Append("tailable", true)
+	}
+	if q.Options.AwaitData {
+		cmd.Append("awaitData", true)
+	}
+	if q.Options.NoCursorTimeout {
+		cmd.Append("noCursorTimeout", true)
+	}
+	if q.Options.PartialResults {
+		cmd.Append("allowPartialResults", true)
+	}
+
+	findOptions := *runFindOptions
+	findOptions.SlaveOk = q.Options.SlaveOk
+	return newCommandCursor(q.Conn, dbname, cmd, &findOptions, &options)
+}
+
+func (r *CommandCursor) getMore() error {
+	cmd := D{{"getMore", r.id}, {"collection", r.collection}}
+	if r.options.BatchSize > 0 {
+		cmd.Append("batchSize", r.options.BatchSize)
+	}
+	if r.options.MaxAwaitTime > 0 {
+		cmd.Append("maxTimeMS", int64(r.options.MaxAwaitTime/time.Millisecond))
+	}
+	var reply cursorReply
+	if err := runInternal(r.conn, r.dbname, cmd, r.findOptions, &reply); err != nil {
+		return err
+	}
+	if err := reply.Err(); err != nil {
+		return err
+	}
+	r.id = reply.Cursor.Id
+	r.batch = reply.Cursor.NextBatch
+	if reply.Cursor.PostBatchResumeToken.Kind != 0 {
+		r.resumeToken = reply.Cursor.PostBatchResumeToken
+	}
+	return nil
+}
+
+// PostBatchResumeToken returns the resume token reported by the server with
+// the most recent batch. The token has zero Kind if the server did not
+// report a token.
+func (r *CommandCursor) PostBatchResumeToken() BSONData {
+	return r.resumeToken
+}
+
+// Close releases the resources used by this cursor.
+func (r *CommandCursor) Close() error {
+	if r.err != nil {
+		return nil
+	}
+	if r.id != 0 {
+		var reply CommandResponse
+		runInternal(r.conn, r.dbname, D{{"killCursors", r.collection}, {"cursors", []int64{r.id}}}, r.findOptions, &reply)
+		r.id = 0
+	}
+	r.batch = nil
+	r.err = errors.New("mongo: cursor closed")
+	r.conn = nil
+	return nil
+}
+
+func (r *CommandCursor) fatal(err error) error {
+	if r.err == nil {
+		r.Close()
+		r.err = err
+	}
+	return err
+}
+
+// Err returns non-nil if the cursor has a permanent error.
+func (r *CommandCursor) Err() error {
+	return r.err
+}
+
+// HasNext returns true if there are more documents to retrieve.
+func (r *CommandCursor) HasNext() bool {
+	// As with the OP_QUERY cursor, errors other than Done are reported as
+	// true so that the error is returned to the application by Next().
+
+	if r.err != nil {
+		return r.err != Done
+	}
+
+	for len(r.batch) == 0 {
+		if r.id == 0 {
+			r.fatal(Done)
+			return false
+		}
+		if err := r.getMore(); err != nil {
+			r.fatal(err)
+			return true
+		}
+		if len(r.batch) == 0 && r.options.Tailable {
+			// Tailable cursor case
+			return false
+		}
+	}
+	return true
+}
+
+// Next fetches the next document from the cursor.
+func (r *CommandCursor) Next(value interface{}) error {
+	if !r.HasNext() {
+		return Done
+	}
+
+	if r.err != nil {
+		return r.err
+	}
+
+	bd := r.batch[0]
+	r.batch[0] = BSONData{}
+	r.batch = r.batch[1:]
+	return bd.Decode(value)
+}
+
+// NextBatch returns the BSON encoding of the documents remaining in the
+// current batch.
+func (r *CommandCursor) NextBatch() ([][]byte, error) {
+	if !r.HasNext() {
+		return nil, Done
+	}
+
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	batch := make([][]byte, len(r.batch))
+	for i, bd := range r.batch {
+		batch[i] = bd.Data
+	}
+	r.batch = nil
+	return batch, nil
+}
+
+// RemainingBatchLength returns the number of documents in the current batch
+// that have not been returned to the application.
+func (r *CommandCursor) RemainingBatchLength() int {
+	return len(r.batch)
+}
+
+// ID returns the server's identifier for the cursor.
+func (r *CommandCursor) ID() int64 {
+	return r.id
+}
@@ -0,0 +1,234 @@
+// Copyright 2011 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package mongo
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// replyCursor is a cursor over a single command reply.
+type replyCursor struct {
+	reply interface{}
+	done  bool
+}
+
+func (r *replyCursor) Close() error  { return nil }
+func (r *replyCursor) Err() error    { return nil }
+func (r *replyCursor) HasNext() bool { return !r.done }
+func (r *replyCursor) ID() int64     { return 0 }
+
+func (r *replyCursor) RemainingBatchLength() int {
+	if r.done {
+		return 0
+	}
+	return 1
+}
+
+func (r *replyCursor) NextBatch() ([][]byte, error) {
+	var bd BSONData
+	if err := r.Next(&bd); err != nil {
+		return nil, err
+	}
+	return [][]byte{bd.Data}, nil
+}
+
+func (r *replyCursor) Next(value interface{}) error {
+	if r.done {
+		return Done
+	}
+	r.done = true
+	data, err := Encode(nil, r.reply)
+	if err != nil {
+		return err
+	}
+	return Decode(data, value)
+}
+
+// commandConn is a fake connection that replies to commands with a function.
+type commandConn struct {
+	fakeConn
+	commands []D
+	reply    func(cmd D) interface{}
+}
+
+func (c *commandConn) Find(namespace string, query interface{}, options *FindOptions) (Cursor, error) {
+	cmd := query.(D)
+	c.commands = append(c.commands, cmd)
+	return &replyCursor{reply: c.reply(cmd)}, nil
+}
+
+func batchReply(id int64, batchName string, docs ...interface{}) interface{} {
+	return D{{"cursor", D{{"id", id}, {"ns", "db.coll"}, {batchName, docs}}}, {"ok", 1.0}}
+}
+
+func TestCommandCursor(t *testing.T) {
+	c := &commandConn{}
+	c.reply = func(cmd D) interface{} {
+		switch cmd[0].Key {
+		case "find":
+			return batchReply(99, "firstBatch", M{"x": 0}, M{"x": 1})
+		case "getMore":
+			if cmd[0].Value != int64(99) {
+				t.Errorf("getMore id = %v, want 99", cmd[0].Value)
+			}
+			if len(c.commands) == 2 {
+				return batchReply(99, "nextBatch", M{"x": 2})
+			}
+			return batchReply(0, "nextBatch", M{"x": 3})
+		}
+		t.Fatalf("unexpected command %v", cmd)
+		return nil
+	}
+
+	q := Collection{Conn: c, Namespace: "db.coll"}.Find(nil).BatchSize(2)
+	r, err := q.CommandCursor()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var xs []int
+	for r.HasNext() {
+		var m struct {
+			X int `bson:"x"`
+		}
+		if err := r.Next(&m); err != nil {
+			t.Fatal(err)
+		}
+		xs = append(xs, m.X)
+	}
+	r.Close()
+
+	if expected := []int{0, 1, 2, 3}; !reflect.DeepEqual(xs, expected) {
+		t.Errorf("results = %v, want %v", xs, expected)
+	}
+	if len(c.commands) != 3 {
+		t.Errorf("%d commands sent, want 3", len(c.commands))
+	}
+	if r.Err() != Done {
+		t.Errorf("Err() = %v, want Done", r.Err())
+	}
+}
+
+func TestCommandCursorKill(t *testing.T) {
+	c := &commandConn{}
+	c.reply = func(cmd D) interface{} {
+		switch cmd[0].Key {
+		case "aggregate":
+			return batchReply(7, "firstBatch", M{"x": 0})
+		case "killCursors":
+			return M{"ok": 1.0}
+		}
+		t.Fatalf("unexpected command %v", cmd)
+		return nil
+	}
+	r, err := Collection{Conn: c, Namespace: "db.coll"}.Aggregate(A{M{"$match": M{}}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Close()
+	last := c.commands[len(c.commands)-1]
+	if last[0].Key != "killCursors" || !reflect.DeepEqual(last[1].Value, []int64{7}) {
+		t.Errorf("close sent %v, want killCursors for cursor 7", last)
+	}
+}
+
+func TestCommandCursorTailable(t *testing.T) {
+	c := &commandConn{}
+	c.reply = func(cmd D) interface{} {
+		switch cmd[0].Key {
+		case "getMore":
+			if cmd[len(cmd)-1].Key != "maxTimeMS" || cmd[len(cmd)-1].Value != int64(250) {
+				t.Errorf("getMore = %v, want maxTimeMS 250", cmd)
+			}
+			return D{{"cursor", D{
+				{"id", int64(5)},
+				{"ns", "db.coll"},
+				{"nextBatch", A{}},
+				{"postBatchResumeToken", M{"_data": "abc"}}}},
+				{"ok", 1.0}}
+		default:
+			return batchReply(5, "firstBatch")
+		}
+	}
+	db := Database{Conn: c, Name: "db"}
+	r, err := db.RunCursor(D{{"aggregate", "coll"}}, &CommandCursorOptions{Tailable: true, MaxAwaitTime: 250 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.HasNext() {
+		t.Fatal("HasNext() = true, want false for empty tailable batch")
+	}
+	if r.Err() != nil {
+		t.Fatalf("Err() = %v, want nil for live tailable cursor", r.Err())
+	}
+	var token M
+	if err := r.PostBatchResumeToken().Decode(&token); err != nil {
+		t.Fatal(err)
+	}
+	if token["_data"] != "abc" {
+		t.Errorf("resume token = %v, want _data: abc", token)
+	}
+}
+
+func TestQueryCommandCursorMaxAwaitTime(t *testing.T) {
+	c := &commandConn{}
+	c.reply = func(cmd D) interface{} {
+		switch cmd[0].Key {
+		case "find":
+			return batchReply(7, "firstBatch")
+		case "getMore":
+			return batchReply(0, "nextBatch", M{"x": 1})
+		}
+		t.Fatalf("unexpected command %v", cmd)
+		return nil
+	}
+	q := Collection{Conn: c, Namespace: "db.coll"}.Find(nil).Tailable(true).AwaitData(true).MaxAwaitTime(2 * time.Second)
+	r, err := q.CommandCursor()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if !r.HasNext() {
+		t.Fatalf("HasNext() = false, err %v", r.Err())
+	}
+	if len(c.commands) != 2 {
+		t.Fatalf("%d commands sent, want 2", len(c.commands))
+	}
+	find, getMore := c.commands[0], c.commands[1]
+	for _, key := range []string{"tailable", "awaitData"} {
+		found := false
+		for _, item := range find {
+			found = found || item.Key == key
+		}
+		if !found {
+			t.Errorf("find = %v, want %s", find, key)
+		}
+	}
+	if item := getMore[len(getMore)-1]; item.Key != "maxTimeMS" || item.Value != int64(2000) {
+		t.Errorf("getMore = %v, want maxTimeMS 2000", getMore)
+	}
+}
+
+func TestCommandCursorError(t *testing.T) {
+	c := &commandConn{}
+	c.reply = func(cmd D) interface{} {
+		return M{"ok": 0.0, "errmsg": "no such command"}
+	}
+	_, err := Database{Conn: c, Name: "db"}.ListCollections(nil)
+	if err == nil || err.Error() != "no such command" {
+		t.Errorf("ListCollections() returned %v, want no such command", err)
+	}
+}
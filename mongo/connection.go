@@ -49,6 +49,25 @@ type connection struct {
 	responseCount int
 	cursor        *cursor
 	br            *bufio.Reader
+
+	// maxDocumentSize is the server's maxBsonObjectSize. If zero, then
+	// DefaultMaxDocumentSize is used.
+	maxDocumentSize int
+}
+
+// DocumentTooLargeError is returned by Insert and Update when an encoded
+// document exceeds the maximum document size of the server. The document is
+// not sent to the server.
+type DocumentTooLargeError struct {
+	// Description of the document. Examples are "insert document 2" and
+	// "update selector".
+	Document string
+	Size     int
+	Max      int
+}
+
+func (e *DocumentTooLargeError) Error() string {
+	return "mongo: " + e.Document + " size " + strconv.Itoa(e.Size) + " exceeds maximum document size " + strconv.Itoa(e.Max)
 }
 
 type cursor struct {
@@ -73,7 +92,48 @@ func Dial(addr string) (Conn, error) {
 		addr:    addr,
 		cursors: make(map[uint32]*cursor),
 	}
-	return &c, c.connect()
+	if err := c.connect(); err != nil {
+		return nil, err
+	}
+	if err := c.readServerLimits(); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return &c, nil
+}
+
+// readServerLimits reads the maximum document size from the server.
+func (c *connection) readServerLimits() error {
+	var result struct {
+		MaxBsonObjectSize int `bson:"maxBsonObjectSize"`
+	}
+	if err := (Database{Conn: c, Name: "admin"}).Run(D{{"isMaster", 1}}, &result); err != nil {
+		return err
+	}
+	c.maxDocumentSize = result.MaxBsonObjectSize
+	return nil
+}
+
+// encodeDocument appends the encoding of doc to b and checks the size of the
+// encoded document. The description and the index, if not negative, are used
+// to identify the document in errors.
+func (c *connection) encodeDocument(b []byte, doc interface{}, description string, index int) ([]byte, error) {
+	offset := len(b)
+	b, err := Encode(b, doc)
+	if err != nil {
+		return nil, err
+	}
+	max := c.maxDocumentSize
+	if max <= 0 {
+		max = DefaultMaxDocumentSize
+	}
+	if n := len(b) - offset; n > max {
+		if index >= 0 {
+			description += " " + strconv.Itoa(index)
+		}
+		return nil, &DocumentTooLargeError{Document: description, Size: n, Max: max}
+	}
+	return b, nil
 }
 
 func (c *connection) connect() error {
@@ -120,8 +180,10 @@ func (c *connection) Err() error {
 	return c.err
 }
 
-// send sets the message length and writes the message to the socket.
+// send sets the message length and writes the message to the socket. The
+// message buffer is returned to the buffer pool.
 func (c *connection) send(msg []byte) error {
+	defer PutBuffer(msg)
 	if c.err != nil {
 		return c.err
 	}
@@ -147,7 +209,7 @@ func (c *connection) Update(namespace string, selector, update interface{}, opti
 		}
 	}
 
-	b := buffer(c.buf[:0])
+	b := buffer(GetBuffer(0))
 	b.Next(4)                    // placeholder for message length
 	b.WriteUint32(c.nextId())    // requestId
 	b.WriteUint32(0)             // responseTo
@@ -155,11 +217,11 @@ func (c *connection) Update(namespace string, selector, update interface{}, opti
 	b.WriteUint32(0)             // reserved
 	b.WriteCString(namespace)    // namespace
 	b.WriteUint32(uint32(flags)) // flags
-	b, err = Encode(b, selector)
+	b, err = c.encodeDocument(b, selector, "update selector", -1)
 	if err != nil {
 		return err
 	}
-	b, err = Encode(b, update)
+	b, err = c.encodeDocument(b, update, "update document", -1)
 	if err != nil {
 		return err
 	}
@@ -176,15 +238,15 @@ func (c *connection) Insert(namespace string, options *InsertOptions, documents
 			flags |= insertContinueOnError
 		}
 	}
-	b := buffer(c.buf[:0])
+	b := buffer(GetBuffer(0))
 	b.Next(4)                    // placeholder for message length
 	b.WriteUint32(c.nextId())    // requestId
 	b.WriteUint32(0)             // responseTo
 	b.WriteUint32(2002)          // opCode
 	b.WriteUint32(uint32(flags)) // flags
 	b.WriteCString(namespace)    // namespace
-	for _, document := range documents {
-		b, err = Encode(b, document)
+	for i, document := range documents {
+		b, err = c.encodeDocument(b, document, "insert document", i)
 		if err != nil {
 			return err
 		}
@@ -202,7 +264,7 @@ func (c *connection) Remove(namespace string, selector interface{}, options *Rem
 			flags |= removeSingle
 		}
 	}
-	b := buffer(c.buf[:0])
+	b := buffer(GetBuffer(0))
 	b.Next(4)                    // placeholder for message length
 	b.WriteUint32(c.nextId())    // requestId
 	b.WriteUint32(0)             // responseTo
@@ -261,7 +323,7 @@ func (c *connection) Find(namespace string, query interface{}, options *FindOpti
 		}
 	}
 
-	b := buffer(c.buf[:0])
+	b := buffer(GetBuffer(0))
 	b.Next(4)                         // placeholder for message length
 	b.WriteUint32(r.requestId)        // requestId
 	b.WriteUint32(0)                  // responseTo
@@ -291,7 +353,7 @@ func (c *connection) Find(namespace string, query interface{}, options *FindOpti
 
 func (c *connection) getMore(r *cursor) error {
 	requestId := c.nextId()
-	b := buffer(c.buf[:0])
+	b := buffer(GetBuffer(0))
 	b.Next(4)                   // placeholder for message length
 	b.WriteUint32(requestId)    // requestId
 	b.WriteUint32(0)            // responseTo
@@ -309,7 +371,7 @@ func (c *connection) getMore(r *cursor) error {
 }
 
 func (c *connection) killCursors(cursorIds ...uint64) error {
-	b := buffer(c.buf[:0])
+	b := buffer(GetBuffer(0))
 	b.Next(4)                             // placeholder for message length
 	b.WriteUint32(c.nextId())             // requestId
 	b.WriteUint32(0)                      // responseTo
@@ -611,3 +673,43 @@ func (r *cursor) Next(value interface{}) error {
 
 	return err
 }
+
+func (r *cursor) NextBatch() ([][]byte, error) {
+	if !r.HasNext() {
+		return nil, Done
+	}
+
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	batch := r.docs
+	r.docs = nil
+	for r.conn.cursor == r {
+		p, err := r.conn.readDoc(true)
+		if err != nil {
+			return nil, r.fatal(err)
+		}
+		batch = append(batch, p)
+	}
+
+	r.count += len(batch)
+	if r.limit > 0 && r.count >= r.limit {
+		batch = batch[:len(batch)-(r.count-r.limit)]
+		r.fatal(Done)
+	}
+
+	return batch, nil
+}
+
+func (r *cursor) RemainingBatchLength() int {
+	n := len(r.docs)
+	if r.conn != nil && r.conn.cursor == r {
+		n += r.conn.responseCount
+	}
+	return n
+}
+
+func (r *cursor) ID() int64 {
+	return int64(r.cursorId)
+}
@@ -14,7 +14,14 @@
 
 package mongo
 
-import "testing"
+import (
+	"bufio"
+	"io"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+)
 
 func dialAndDrop(t *testing.T, dbname, collectionName string) Collection {
 	c, err := Dial("127.0.0.1")
@@ -254,3 +261,173 @@ func TestCursorCloseAfterConnectionClose(t *testing.T) {
 	r.Close()
 	r.Next(&m)
 }
+
+// pipeConnection returns a connection to a fake server. The server replies to
+// queries and get mores with the given batches of documents.
+func pipeConnection(t *testing.T, batches [][]interface{}) *connection {
+	client, server := net.Pipe()
+	go func() {
+		defer server.Close()
+		for {
+			var header [16]byte
+			if _, err := io.ReadFull(server, header[:]); err != nil {
+				return
+			}
+			body := make([]byte, int(wire.Uint32(header[0:4]))-16)
+			if _, err := io.ReadFull(server, body); err != nil {
+				return
+			}
+			opCode := wire.Uint32(header[12:16])
+			if opCode != 2004 && opCode != 2005 {
+				continue
+			}
+			var docs []interface{}
+			if len(batches) > 0 {
+				docs = batches[0]
+				batches = batches[1:]
+			}
+			var cursorId uint64
+			if len(batches) > 0 {
+				cursorId = 42
+			}
+			b := buffer(nil)
+			b.Next(4)
+			b.WriteUint32(0)                 // requestId
+			b.Write(header[4:8])             // responseTo
+			b.WriteUint32(1)                 // opCode
+			b.WriteUint32(0)                 // flags
+			b.WriteUint64(cursorId)          // cursorId
+			b.WriteUint32(0)                 // startingFrom
+			b.WriteUint32(uint32(len(docs))) // numberReturned
+			for _, doc := range docs {
+				var err error
+				b, err = Encode(b, doc)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+			}
+			wire.PutUint32(b[0:4], uint32(len(b)))
+			if _, err := server.Write(b); err != nil {
+				return
+			}
+		}
+	}()
+	return &connection{
+		conn:    client,
+		br:      bufio.NewReader(client),
+		cursors: make(map[uint32]*cursor),
+	}
+}
+
+func TestCursorBatch(t *testing.T) {
+	c := pipeConnection(t, [][]interface{}{
+		{M{"x": 0}, M{"x": 1}, M{"x": 2}},
+		{M{"x": 3}, M{"x": 4}},
+	})
+	defer c.Close()
+
+	r, err := c.Find("db.coll", nil, &FindOptions{BatchSize: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	var m M
+	if err := r.Next(&m); err != nil {
+		t.Fatal(err)
+	}
+	if n := r.RemainingBatchLength(); n != 2 {
+		t.Errorf("RemainingBatchLength() = %d, want 2", n)
+	}
+	if id := r.ID(); id != 42 {
+		t.Errorf("ID() = %d, want 42", id)
+	}
+
+	var xs []interface{}
+	for {
+		batch, err := r.NextBatch()
+		if err == Done {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, p := range batch {
+			var m M
+			if err := Decode(p, &m); err != nil {
+				t.Fatal(err)
+			}
+			xs = append(xs, m["x"])
+		}
+		if n := r.RemainingBatchLength(); n != 0 {
+			t.Errorf("RemainingBatchLength() after NextBatch = %d, want 0", n)
+		}
+	}
+	if expected := []interface{}{1, 2, 3, 4}; !reflect.DeepEqual(xs, expected) {
+		t.Errorf("batches = %v, want %v", xs, expected)
+	}
+	if id := r.ID(); id != 0 {
+		t.Errorf("ID() after last batch = %d, want 0", id)
+	}
+}
+
+func TestCursorBatchLimit(t *testing.T) {
+	c := pipeConnection(t, [][]interface{}{
+		{M{"x": 0}, M{"x": 1}},
+		{M{"x": 2}, M{"x": 3}},
+	})
+	defer c.Close()
+
+	r, err := c.Find("db.coll", nil, &FindOptions{Limit: 3, BatchSize: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	n := 0
+	for {
+		batch, err := r.NextBatch()
+		if err == Done {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		n += len(batch)
+	}
+	if n != 3 {
+		t.Errorf("got %d documents, want 3", n)
+	}
+}
+
+func TestDocumentTooLarge(t *testing.T) {
+	c := pipeConnection(t, [][]interface{}{
+		{M{"ok": 1, "maxBsonObjectSize": 100}},
+	})
+	defer c.Close()
+
+	if err := c.readServerLimits(); err != nil {
+		t.Fatal(err)
+	}
+	if c.maxDocumentSize != 100 {
+		t.Fatalf("maxDocumentSize = %d, want 100", c.maxDocumentSize)
+	}
+
+	small := M{"x": 1}
+	large := M{"x": strings.Repeat("a", 100)}
+	err := c.Insert("db.coll", nil, small, large)
+	e, ok := err.(*DocumentTooLargeError)
+	if !ok {
+		t.Fatalf("Insert() returned %v, want DocumentTooLargeError", err)
+	}
+	if e.Document != "insert document 1" || e.Max != 100 || e.Size <= 100 {
+		t.Errorf("Insert() returned %+v", e)
+	}
+	if err := c.Update("db.coll", small, large, nil); err == nil {
+		t.Error("Update() with large document did not return error")
+	}
+	if err := c.Insert("db.coll", nil, small); err != nil {
+		t.Errorf("Insert() of small document returned %v", err)
+	}
+}
@@ -0,0 +1,334 @@
+// Copyright 2011 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package mongo
+
+import (
+	"errors"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Decimal128 represents a BSON 128-bit decimal floating point value. The
+// value uses the IEEE 754-2008 decimal128 format with binary integer
+// significand encoding.
+//
+// The zero value of Decimal128 is 0E-6176.
+type Decimal128 struct {
+	h, l uint64
+}
+
+const (
+	decimal128MaxDigits = 34
+	decimal128Bias      = 6176
+	decimal128MinExp    = -6176
+	decimal128MaxExp    = 6111
+
+	decimal128SignBit = 1 << 63
+	decimal128NaN     = 0x7c00000000000000
+	decimal128Inf     = 0x7800000000000000
+)
+
+var (
+	decimal128MaxCoefficient = new(big.Int).Sub(new(big.Int).Exp(big.NewInt(10), big.NewInt(decimal128MaxDigits), nil), big.NewInt(1))
+	bigTen                   = big.NewInt(10)
+)
+
+// NewDecimal128 returns the decimal with the given high and low 64 bits of
+// the IEEE 754-2008 encoding.
+func NewDecimal128(high, low uint64) Decimal128 {
+	return Decimal128{h: high, l: low}
+}
+
+// Decimal128NaN returns a decimal NaN value.
+func Decimal128NaN() Decimal128 {
+	return Decimal128{h: decimal128NaN}
+}
+
+// Decimal128Inf returns positive infinity if sign >= 0, negative infinity if
+// sign < 0.
+func Decimal128Inf(sign int) Decimal128 {
+	if sign < 0 {
+		return Decimal128{h: decimal128Inf | decimal128SignBit}
+	}
+	return Decimal128{h: decimal128Inf}
+}
+
+// Bits returns the high and low 64 bits of the IEEE 754-2008 encoding of d.
+func (d Decimal128) Bits() (high, low uint64) {
+	return d.h, d.l
+}
+
+// IsNaN returns true if d is a NaN value.
+func (d Decimal128) IsNaN() bool {
+	return d.h&0x7c00000000000000 == decimal128NaN
+}
+
+// IsInf reports whether d is an infinity, according to sign. If sign > 0,
+// IsInf reports whether d is positive infinity. If sign < 0, IsInf reports
+// whether d is negative infinity. If sign == 0, IsInf reports whether d is
+// either infinity.
+func (d Decimal128) IsInf(sign int) bool {
+	if d.h&0x7c00000000000000 != decimal128Inf {
+		return false
+	}
+	neg := d.h&decimal128SignBit != 0
+	return sign == 0 || (sign > 0 && !neg) || (sign < 0 && neg)
+}
+
+// parts returns the sign, coefficient and exponent of a finite decimal.
+func (d Decimal128) parts() (neg bool, coef *big.Int, exp int) {
+	neg = d.h&decimal128SignBit != 0
+	var high uint64
+	if d.h>>61&3 == 3 {
+		// The coefficient has the implicit prefix 100 and is larger than
+		// the maximum coefficient. Non-canonical values are zero.
+		exp = int(d.h>>47&(1<<14-1)) - decimal128Bias
+		return neg, new(big.Int), exp
+	}
+	exp = int(d.h>>49&(1<<14-1)) - decimal128Bias
+	high = d.h & (1<<49 - 1)
+	coef = new(big.Int).SetUint64(high)
+	coef.Lsh(coef, 64)
+	coef.Or(coef, new(big.Int).SetUint64(d.l))
+	if coef.Cmp(decimal128MaxCoefficient) > 0 {
+		coef.SetInt64(0)
+	}
+	return neg, coef, exp
+}
+
+// String returns the string representation of d using the format specified
+// by the BSON decimal128 specification.
+func (d Decimal128) String() string {
+	switch {
+	case d.IsNaN():
+		return "NaN"
+	case d.IsInf(1):
+		return "Infinity"
+	case d.IsInf(-1):
+		return "-Infinity"
+	}
+
+	neg, coef, exp := d.parts()
+	digits := coef.String()
+	adjusted := exp + len(digits) - 1
+
+	var buf []byte
+	if neg {
+		buf = append(buf, '-')
+	}
+	switch {
+	case exp <= 0 && adjusted >= -6:
+		switch {
+		case exp == 0:
+			buf = append(buf, digits...)
+		case len(digits) > -exp:
+			buf = append(buf, digits[:len(digits)+exp]...)
+			buf = append(buf, '.')
+			buf = append(buf, digits[len(digits)+exp:]...)
+		default:
+			buf = append(buf, "0."...)
+			for i := 0; i < -exp-len(digits); i++ {
+				buf = append(buf, '0')
+			}
+			buf = append(buf, digits...)
+		}
+	default:
+		buf = append(buf, digits[0])
+		if len(digits) > 1 {
+			buf = append(buf, '.')
+			buf = append(buf, digits[1:]...)
+		}
+		buf = append(buf, 'E')
+		if adjusted >= 0 {
+			buf = append(buf, '+')
+		}
+		buf = strconv.AppendInt(buf, int64(adjusted), 10)
+	}
+	return string(buf)
+}
+
+// BigInt returns the coefficient and exponent of d such that the value of d
+// is coef * 10**exp. BigInt returns an error if d is NaN or infinite.
+func (d Decimal128) BigInt() (coef *big.Int, exp int, err error) {
+	if d.IsNaN() || d.IsInf(0) {
+		return nil, 0, errors.New("mongo: cannot convert " + d.String() + " to big.Int")
+	}
+	neg, coef, exp := d.parts()
+	if neg {
+		coef.Neg(coef)
+	}
+	return coef, exp, nil
+}
+
+// Decimal128FromBigInt returns the decimal with value coef * 10**exp. If coef
+// has more than 34 digits or the exponent is below the minimum exponent,
+// then the value is rounded to the nearest representable value with ties
+// rounded to even. An error is returned if the value is too large to
+// represent.
+func Decimal128FromBigInt(coef *big.Int, exp int) (Decimal128, error) {
+	return decimal128FromParts(coef.Sign() < 0, new(big.Int).Abs(coef), exp, false)
+}
+
+var (
+	errDecimal128Range   = errors.New("mongo: decimal128 value out of range")
+	errDecimal128Inexact = errors.New("mongo: decimal128 value cannot be represented exactly")
+)
+
+// decimal128FromParts returns the decimal with the given sign, coefficient
+// and exponent. The coefficient is modified. If exact is true, then
+// errDecimal128Inexact is returned instead of rounding the value.
+func decimal128FromParts(neg bool, coef *big.Int, exp int, exact bool) (Decimal128, error) {
+	if n := len(coef.String()); n > decimal128MaxDigits || exp < decimal128MinExp {
+		drop := n - decimal128MaxDigits
+		if d := decimal128MinExp - exp; d > drop {
+			drop = d
+		}
+		if !roundDigits(coef, drop) && exact {
+			return Decimal128{}, errDecimal128Inexact
+		}
+		exp += drop
+		if coef.Cmp(decimal128MaxCoefficient) > 0 {
+			coef.Quo(coef, bigTen)
+			exp += 1
+		}
+	}
+
+	if exp > decimal128MaxExp {
+		if coef.Sign() == 0 {
+			exp = decimal128MaxExp
+		}
+		// Clamp the exponent by adding trailing zeros to the coefficient.
+		for exp > decimal128MaxExp {
+			c := new(big.Int).Mul(coef, bigTen)
+			if c.Cmp(decimal128MaxCoefficient) > 0 {
+				return Decimal128{}, errDecimal128Range
+			}
+			coef = c
+			exp -= 1
+		}
+	}
+
+	var d Decimal128
+	d.l = coef.Uint64()
+	d.h = new(big.Int).Rsh(coef, 64).Uint64()
+	d.h |= uint64(exp+decimal128Bias) << 49
+	if neg {
+		d.h |= decimal128SignBit
+	}
+	return d, nil
+}
+
+// roundDigits divides coef by 10**n, rounding half to even. The function
+// returns true if no nonzero digits were discarded.
+func roundDigits(coef *big.Int, n int) bool {
+	if n <= 0 {
+		return true
+	}
+	if n > len(coef.String()) {
+		// The value is less than half of the last digit.
+		exact := coef.Sign() == 0
+		coef.SetInt64(0)
+		return exact
+	}
+	divisor := new(big.Int).Exp(bigTen, big.NewInt(int64(n)), nil)
+	rem := new(big.Int)
+	coef.QuoRem(coef, divisor, rem)
+	exact := rem.Sign() == 0
+	rem.Lsh(rem, 1)
+	switch c := rem.Cmp(divisor); {
+	case c > 0, c == 0 && coef.Bit(0) == 1:
+		coef.Add(coef, big.NewInt(1))
+	}
+	return exact
+}
+
+// ParseDecimal128 parses a string in decimal or scientific notation to a
+// decimal. The strings "NaN", "Inf" and "Infinity" are also accepted, ignoring
+// case and with an optional sign.
+//
+// An error is returned if the value is too large to represent or if the value
+// cannot be represented without rounding. Trailing zeros beyond 34 significant
+// digits and zeros with an exponent below the minimum are accepted because
+// the value is unchanged.
+func ParseDecimal128(s string) (Decimal128, error) {
+	in := s
+	neg := false
+	if len(s) > 0 && (s[0] == '+' || s[0] == '-') {
+		neg = s[0] == '-'
+		s = s[1:]
+	}
+
+	switch strings.ToLower(s) {
+	case "nan":
+		return Decimal128NaN(), nil
+	case "inf", "infinity":
+		if neg {
+			return Decimal128Inf(-1), nil
+		}
+		return Decimal128Inf(1), nil
+	}
+
+	var digits []byte
+	exp := 0
+	sawDigit := false
+	sawPoint := false
+	i := 0
+	for ; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c >= '0' && c <= '9':
+			sawDigit = true
+			if sawPoint {
+				exp -= 1
+			}
+			if c != '0' || len(digits) > 0 {
+				digits = append(digits, c)
+			}
+			continue
+		case c == '.' && !sawPoint:
+			sawPoint = true
+			continue
+		}
+		break
+	}
+	if !sawDigit {
+		return Decimal128{}, errors.New("mongo: invalid decimal128 string " + strconv.Quote(in))
+	}
+	if i < len(s) {
+		if s[i] != 'e' && s[i] != 'E' || i+1 == len(s) {
+			return Decimal128{}, errors.New("mongo: invalid decimal128 string " + strconv.Quote(in))
+		}
+		e, err := strconv.Atoi(s[i+1:])
+		if err != nil || strings.HasPrefix(s[i+1:], "+-") {
+			return Decimal128{}, errors.New("mongo: invalid decimal128 string " + strconv.Quote(in))
+		}
+		exp += e
+	}
+
+	coef := new(big.Int)
+	if len(digits) > 0 {
+		coef.SetString(string(digits), 10)
+	}
+	d, err := decimal128FromParts(neg, coef, exp, true)
+	switch err {
+	case nil:
+	case errDecimal128Inexact:
+		return Decimal128{}, errors.New("mongo: decimal128 string " + strconv.Quote(in) + " cannot be represented exactly")
+	default:
+		return Decimal128{}, errors.New("mongo: decimal128 string " + strconv.Quote(in) + " out of range")
+	}
+	return d, nil
+}
@@ -0,0 +1,167 @@
+// Copyright 2011 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package mongo
+
+import (
+	"math/big"
+	"testing"
+)
+
+var decimal128Tests = []struct {
+	s    string
+	h, l uint64
+	out  string
+}{
+	{"0", 0x3040000000000000, 0, "0"},
+	{"-0", 0xb040000000000000, 0, "-0"},
+	{"1", 0x3040000000000000, 1, "1"},
+	{"-1", 0xb040000000000000, 1, "-1"},
+	{"0.1", 0x303e000000000000, 1, "0.1"},
+	{"NaN", 0x7c00000000000000, 0, "NaN"},
+	{"-nan", 0x7c00000000000000, 0, "NaN"},
+	{"Infinity", 0x7800000000000000, 0, "Infinity"},
+	{"-Inf", 0xf800000000000000, 0, "-Infinity"},
+	{"0.001234", 0x3034000000000000, 1234, "0.001234"},
+	{"1E+3", 0x3046000000000000, 1, "1E+3"},
+	{"1e3", 0x3046000000000000, 1, "1E+3"},
+	{"-100E-10", 0xb02c000000000000, 100, "-1.00E-8"},
+	{"0.0000001234", 0x302c000000000000, 1234, "1.234E-7"},
+	{"1E-6176", 0x0000000000000000, 1, "1E-6176"},
+	{"0E-6177", 0x0000000000000000, 0, "0E-6176"},
+	{"0E+6112", 0x5ffe000000000000, 0, "0E+6111"},
+	{"1E+6112", 0x5ffe000000000000, 10, "1.0E+6112"},
+	{"9.999999999999999999999999999999999E+6144", 0x5fffed09bead87c0, 0x378d8e63ffffffff, "9.999999999999999999999999999999999E+6144"},
+	{"10000000000000000000000000000000000", 0x3042314dc6448d93, 0x38c15b0a00000000, "1.000000000000000000000000000000000E+34"},
+	{"12345678901234567890123456789012340", 0x30423cde6fff9732, 0xde825cd07e96aff2, "1.234567890123456789012345678901234E+34"},
+	{"1.0E-6176", 0x0000000000000000, 1, "1E-6176"},
+}
+
+func TestDecimal128(t *testing.T) {
+	for _, tt := range decimal128Tests {
+		d, err := ParseDecimal128(tt.s)
+		if err != nil {
+			t.Errorf("ParseDecimal128(%q) returned error %v", tt.s, err)
+			continue
+		}
+		if h, l := d.Bits(); !d.IsNaN() && (h != tt.h || l != tt.l) {
+			t.Errorf("ParseDecimal128(%q) = %#x %#x, want %#x %#x", tt.s, h, l, tt.h, tt.l)
+		}
+		if s := d.String(); s != tt.out {
+			t.Errorf("ParseDecimal128(%q).String() = %q, want %q", tt.s, s, tt.out)
+		}
+		if s := NewDecimal128(tt.h, tt.l).String(); s != tt.out {
+			t.Errorf("NewDecimal128(%#x, %#x).String() = %q, want %q", tt.h, tt.l, s, tt.out)
+		}
+	}
+}
+
+func TestDecimal128Rounding(t *testing.T) {
+	for _, tt := range []struct {
+		coef     string
+		exp      int
+		expected string
+	}{
+		{"12345678901234567890123456789012345", 0, "1.234567890123456789012345678901234E+34"},
+		{"12345678901234567890123456789012355", 0, "1.234567890123456789012345678901236E+34"},
+		{"99999999999999999999999999999999999", 0, "1.000000000000000000000000000000000E+35"},
+		{"15", -6177, "2E-6176"},
+		{"25", -6177, "2E-6176"},
+		{"251", -6178, "3E-6176"},
+	} {
+		coef, _ := new(big.Int).SetString(tt.coef, 10)
+		d, err := Decimal128FromBigInt(coef, tt.exp)
+		if err != nil {
+			t.Errorf("Decimal128FromBigInt(%s, %d) returned error %v", tt.coef, tt.exp, err)
+			continue
+		}
+		if s := d.String(); s != tt.expected {
+			t.Errorf("Decimal128FromBigInt(%s, %d) = %q, want %q", tt.coef, tt.exp, s, tt.expected)
+		}
+	}
+}
+
+func TestDecimal128Errors(t *testing.T) {
+	for _, s := range []string{"", "-", ".", "1.2.3", "E3", "1E", "1E+", "1E+-3", "abc", "1x", "1E+6145", "-1E+6145",
+		// Parse errors from the BSON corpus.
+		"Infi", "Infin", "Infini", "Infinit", "-Infinit", ".Infinity", "NaNq", "NaNs", "..1", "1..", "E02", "e", "1ee",
+		"100000000000000000000000000000000000000000000000000000000001",
+		"1E-6177",
+		"12345678901234567890123456789012345",
+		"1.5E-6176",
+	} {
+		if _, err := ParseDecimal128(s); err == nil {
+			t.Errorf("ParseDecimal128(%q) did not return error", s)
+		}
+	}
+}
+
+func TestDecimal128BigInt(t *testing.T) {
+	coef, _ := new(big.Int).SetString("-123456789012345678901234567890", 10)
+	d, err := Decimal128FromBigInt(coef, -10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s, expected := d.String(), "-12345678901234567890.1234567890"; s != expected {
+		t.Errorf("Decimal128FromBigInt() = %q, want %q", s, expected)
+	}
+	c, exp, err := d.BigInt()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Cmp(coef) != 0 || exp != -10 {
+		t.Errorf("BigInt() = %v, %d, want %v, -10", c, exp, coef)
+	}
+	if _, _, err := Decimal128NaN().BigInt(); err == nil {
+		t.Error("NaN.BigInt() did not return error")
+	}
+	if _, _, err := Decimal128Inf(-1).BigInt(); err == nil {
+		t.Error("-Infinity.BigInt() did not return error")
+	}
+}
+
+func TestDecimal128NonCanonical(t *testing.T) {
+	// Coefficients with the implicit 100 prefix or greater than 10**34-1 are
+	// zero.
+	if s := NewDecimal128(0x6c10000000000000, 0).String(); s != "0" {
+		t.Errorf("non-canonical = %q, want 0", s)
+	}
+	if s := NewDecimal128(0x3041ed09bead87c0, 0x378d8e6400000000).String(); s != "0" {
+		t.Errorf("coefficient 10**34 = %q, want 0", s)
+	}
+}
+
+func TestDecodeDecimal128Interface(t *testing.T) {
+	d, _ := ParseDecimal128("1.05")
+	data, err := Encode(nil, M{"test": d, "x": 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m M
+	if err := Decode(data, &m); err != nil {
+		t.Fatal(err)
+	}
+	if m["test"] != d {
+		t.Errorf("decoded %v, want %v", m["test"], d)
+	}
+	var st struct {
+		X int `bson:"x"`
+	}
+	if err := Decode(data, &st); err != nil {
+		t.Fatal(err)
+	}
+	if st.X != 1 {
+		t.Errorf("x = %d, want 1 after skipping decimal", st.X)
+	}
+}
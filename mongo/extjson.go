@@ -0,0 +1,694 @@
+// Copyright 2011 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package mongo
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ExtJSONMode specifies the format of MongoDB Extended JSON.
+type ExtJSONMode int
+
+const (
+	// ExtJSONCanonical is the Extended JSON v2 canonical format. The format
+	// preserves the BSON type of every value.
+	ExtJSONCanonical ExtJSONMode = iota
+
+	// ExtJSONRelaxed is the Extended JSON v2 relaxed format. Numbers and
+	// recent dates are written as native JSON values. The format does not
+	// preserve the distinction between the BSON number types.
+	ExtJSONRelaxed
+
+	// ExtJSONShell is the legacy format used by the mongo shell. The output
+	// is not valid JSON and cannot be parsed by FromExtJSON.
+	ExtJSONShell
+)
+
+// ToExtJSON converts the BSON document in data to MongoDB Extended JSON using
+// the given mode.
+//
+// More information: https://github.com/mongodb/specifications/blob/master/source/extended-json.rst
+func ToExtJSON(data []byte, mode ExtJSONMode) (result []byte, err error) {
+	defer handleAbort(&err)
+	w := extJSONWriter{decodeState: decodeState{data: data}, mode: mode}
+	w.writeDoc(false)
+	if w.offset != len(data) {
+		return nil, errors.New("bson: extra data after document")
+	}
+	return w.buf, nil
+}
+
+type extJSONWriter struct {
+	decodeState
+	buf  []byte
+	mode ExtJSONMode
+}
+
+func (w *extJSONWriter) writeDoc(array bool) {
+	offset := w.beginDoc()
+	open, close := byte('{'), byte('}')
+	if array {
+		open, close = '[', ']'
+	}
+	w.buf = append(w.buf, open)
+	for i := 0; ; i++ {
+		kind, name := w.scanKindName()
+		if kind == 0 {
+			break
+		}
+		if i > 0 {
+			w.buf = append(w.buf, ',')
+		}
+		if !array {
+			w.buf = appendJSONString(w.buf, string(name))
+			w.buf = append(w.buf, ':')
+		}
+		w.writeValue(kind)
+	}
+	w.buf = append(w.buf, close)
+	w.endDoc(offset)
+}
+
+// writeWrapper writes the beginning of a wrapper document {"key":
+func (w *extJSONWriter) writeWrapper(key string) {
+	w.buf = append(w.buf, `{"`...)
+	w.buf = append(w.buf, key...)
+	w.buf = append(w.buf, `":`...)
+}
+
+func (w *extJSONWriter) writeValue(kind int) {
+	shell := w.mode == ExtJSONShell
+	switch kind {
+	case KindFloat:
+		f := w.scanFloat()
+		s := formatExtJSONFloat(f)
+		switch {
+		case shell || (w.mode == ExtJSONRelaxed && !math.IsInf(f, 0) && !math.IsNaN(f)):
+			w.buf = append(w.buf, s...)
+		default:
+			w.writeWrapper("$numberDouble")
+			w.buf = appendJSONString(w.buf, s)
+			w.buf = append(w.buf, '}')
+		}
+	case KindString:
+		w.buf = appendJSONString(w.buf, w.scanString())
+	case KindDocument:
+		w.writeDoc(false)
+	case KindArray:
+		w.writeDoc(true)
+	case KindBinary:
+		p, subtype := w.scanBinary()
+		data := base64.StdEncoding.EncodeToString(p)
+		if shell {
+			w.buf = append(w.buf, fmt.Sprintf("BinData(%d,%q)", subtype, data)...)
+		} else {
+			w.buf = append(w.buf, fmt.Sprintf(`{"$binary":{"base64":%q,"subType":"%02x"}}`, data, subtype)...)
+		}
+	case KindUndefined:
+		if shell {
+			w.buf = append(w.buf, "undefined"...)
+		} else {
+			w.buf = append(w.buf, `{"$undefined":true}`...)
+		}
+	case KindObjectId:
+		w.writeObjectId(ObjectId(w.scanSlice(12)))
+	case KindBool:
+		w.buf = strconv.AppendBool(w.buf, w.scanBool())
+	case KindDateTime:
+		ms := w.scanInt64()
+		t := timeFromMS(ms)
+		iso := t.Format("2006-01-02T15:04:05.999Z07:00")
+		switch {
+		case shell && t.Year() >= 0 && t.Year() <= 9999:
+			w.buf = append(w.buf, `ISODate("`+iso+`")`...)
+		case shell:
+			w.buf = append(w.buf, "new Date("+strconv.FormatInt(ms, 10)+")"...)
+		case w.mode == ExtJSONRelaxed && t.Year() >= 1970 && t.Year() <= 9999:
+			w.writeWrapper("$date")
+			w.buf = appendJSONString(w.buf, iso)
+			w.buf = append(w.buf, '}')
+		default:
+			w.buf = append(w.buf, `{"$date":{"$numberLong":"`+strconv.FormatInt(ms, 10)+`"}}`...)
+		}
+	case KindNull:
+		w.buf = append(w.buf, "null"...)
+	case KindRegexp:
+		r := w.scanRegexp()
+		if shell {
+			w.buf = append(w.buf, "/"+r.Pattern+"/"+r.Options...)
+		} else {
+			w.buf = append(w.buf, `{"$regularExpression":{"pattern":`...)
+			w.buf = appendJSONString(w.buf, r.Pattern)
+			w.buf = append(w.buf, `,"options":`...)
+			w.buf = appendJSONString(w.buf, r.Options)
+			w.buf = append(w.buf, "}}"...)
+		}
+	case KindDBPointer:
+		p := w.scanDBPointer()
+		if shell {
+			w.buf = append(w.buf, "DBPointer("...)
+			w.buf = appendJSONString(w.buf, p.Namespace)
+			w.buf = append(w.buf, ", "...)
+			w.writeObjectId(p.Id)
+			w.buf = append(w.buf, ')')
+		} else {
+			w.buf = append(w.buf, `{"$dbPointer":{"$ref":`...)
+			w.buf = appendJSONString(w.buf, p.Namespace)
+			w.buf = append(w.buf, `,"$id":`...)
+			w.writeObjectId(p.Id)
+			w.buf = append(w.buf, "}}"...)
+		}
+	case KindCode:
+		w.writeWrapper("$code")
+		w.buf = appendJSONString(w.buf, w.scanString())
+		w.buf = append(w.buf, '}')
+	case KindSymbol:
+		s := w.scanString()
+		if shell {
+			w.buf = appendJSONString(w.buf, s)
+		} else {
+			w.writeWrapper("$symbol")
+			w.buf = appendJSONString(w.buf, s)
+			w.buf = append(w.buf, '}')
+		}
+	case KindCodeWithScope:
+		offset := w.beginDoc()
+		w.writeWrapper("$code")
+		w.buf = appendJSONString(w.buf, w.scanString())
+		w.buf = append(w.buf, `,"$scope":`...)
+		w.writeDoc(false)
+		w.buf = append(w.buf, '}')
+		w.endDoc(offset)
+	case KindInt32:
+		n := w.scanInt32()
+		if w.mode == ExtJSONCanonical {
+			w.buf = append(w.buf, `{"$numberInt":"`+strconv.Itoa(int(n))+`"}`...)
+		} else {
+			w.buf = strconv.AppendInt(w.buf, int64(n), 10)
+		}
+	case KindTimestamp:
+		ts := uint64(w.scanInt64())
+		t, i := strconv.FormatUint(ts>>32, 10), strconv.FormatUint(ts&0xffffffff, 10)
+		if shell {
+			w.buf = append(w.buf, "Timestamp("+t+", "+i+")"...)
+		} else {
+			w.buf = append(w.buf, `{"$timestamp":{"t":`+t+`,"i":`+i+`}}`...)
+		}
+	case KindInt64:
+		n := w.scanInt64()
+		s := strconv.FormatInt(n, 10)
+		switch {
+		case shell && n > -1<<53 && n < 1<<53:
+			w.buf = append(w.buf, "NumberLong("+s+")"...)
+		case shell:
+			w.buf = append(w.buf, `NumberLong("`+s+`")`...)
+		case w.mode == ExtJSONRelaxed:
+			w.buf = append(w.buf, s...)
+		default:
+			w.buf = append(w.buf, `{"$numberLong":"`+s+`"}`...)
+		}
+	case KindDecimal128:
+		s := w.scanDecimal128().String()
+		if shell {
+			w.buf = append(w.buf, `NumberDecimal("`+s+`")`...)
+		} else {
+			w.buf = append(w.buf, `{"$numberDecimal":"`+s+`"}`...)
+		}
+	case KindMinValue:
+		if shell {
+			w.buf = append(w.buf, "MinKey"...)
+		} else {
+			w.buf = append(w.buf, `{"$minKey":1}`...)
+		}
+	case KindMaxValue:
+		if shell {
+			w.buf = append(w.buf, "MaxKey"...)
+		} else {
+			w.buf = append(w.buf, `{"$maxKey":1}`...)
+		}
+	default:
+		abort(&DecodeTypeError{kind})
+	}
+}
+
+func (w *extJSONWriter) writeObjectId(id ObjectId) {
+	if w.mode == ExtJSONShell {
+		w.buf = append(w.buf, `ObjectId("`+id.String()+`")`...)
+	} else {
+		w.buf = append(w.buf, `{"$oid":"`+id.String()+`"}`...)
+	}
+}
+
+// formatExtJSONFloat formats f in the canonical form used by the BSON corpus:
+// the shortest representation that parses to f, in exponent notation when
+// the decimal exponent is less than -4 or greater than 15 and otherwise in
+// decimal notation with at least one digit after the decimal point.
+func formatExtJSONFloat(f float64) string {
+	switch {
+	case math.IsNaN(f):
+		return "NaN"
+	case math.IsInf(f, 1):
+		return "Infinity"
+	case math.IsInf(f, -1):
+		return "-Infinity"
+	}
+	s := strconv.FormatFloat(f, 'e', -1, 64)
+	i := strings.IndexByte(s, 'e')
+	exp, _ := strconv.Atoi(s[i+1:])
+	if exp < -4 || exp >= 16 {
+		sign := "+"
+		if exp < 0 {
+			sign = "-"
+			exp = -exp
+		}
+		e := strconv.Itoa(exp)
+		if len(e) < 2 {
+			e = "0" + e
+		}
+		return s[:i] + "E" + sign + e
+	}
+	s = strconv.FormatFloat(f, 'f', -1, 64)
+	if !strings.Contains(s, ".") {
+		s += ".0"
+	}
+	return s
+}
+
+func appendJSONString(buf []byte, s string) []byte {
+	const hexDigits = "0123456789abcdef"
+	buf = append(buf, '"')
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c < utf8.RuneSelf {
+			switch {
+			case c == '"' || c == '\\':
+				buf = append(buf, '\\', c)
+			case c == '\n':
+				buf = append(buf, '\\', 'n')
+			case c == '\r':
+				buf = append(buf, '\\', 'r')
+			case c == '\t':
+				buf = append(buf, '\\', 't')
+			case c < 0x20:
+				buf = append(buf, '\\', 'u', '0', '0', hexDigits[c>>4], hexDigits[c&0xf])
+			default:
+				buf = append(buf, c)
+			}
+			i += 1
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			buf = append(buf, `�`...)
+		} else {
+			buf = append(buf, s[i:i+size]...)
+		}
+		i += size
+	}
+	return append(buf, '"')
+}
+
+// FromExtJSON converts a JSON object in MongoDB Extended JSON format to a BSON
+// document. Both the canonical and relaxed formats are accepted along with the
+// legacy $binary/$type, $regex/$options and numeric $date wrappers. The order
+// of keys in the JSON object is preserved.
+func FromExtJSON(data []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	if tok != json.Delim('{') {
+		return nil, errors.New("bson: extended JSON must be an object")
+	}
+	v, err := parseExtJSONObject(dec)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, errors.New("bson: extra data after extended JSON object")
+	}
+	doc, ok := v.(D)
+	if !ok {
+		return nil, errors.New("bson: extended JSON must be an object")
+	}
+	return Encode(nil, doc)
+}
+
+func parseExtJSONValue(dec *json.Decoder) (interface{}, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch tok := tok.(type) {
+	case json.Delim:
+		switch tok {
+		case '{':
+			return parseExtJSONObject(dec)
+		case '[':
+			a := A{}
+			for dec.More() {
+				v, err := parseExtJSONValue(dec)
+				if err != nil {
+					return nil, err
+				}
+				a = append(a, v)
+			}
+			_, err := dec.Token()
+			return a, err
+		}
+		return nil, fmt.Errorf("bson: unexpected %v in extended JSON", tok)
+	case json.Number:
+		return parseExtJSONNumber(string(tok))
+	case nil:
+		return BSONData{Kind: KindNull}, nil
+	default:
+		return tok, nil
+	}
+}
+
+func parseExtJSONNumber(s string) (interface{}, error) {
+	if !strings.ContainsAny(s, ".eE") {
+		if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+			if n >= math.MinInt32 && n <= math.MaxInt32 {
+				return int32(n), nil
+			}
+			return n, nil
+		}
+	}
+	return strconv.ParseFloat(s, 64)
+}
+
+func parseExtJSONObject(dec *json.Decoder) (interface{}, error) {
+	var doc D
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		key := tok.(string)
+		v, err := parseExtJSONValue(dec)
+		if err != nil {
+			return nil, err
+		}
+		doc = append(doc, DocItem{key, v})
+	}
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+	if doc == nil {
+		return D{}, nil
+	}
+	if len(doc[0].Key) > 0 && doc[0].Key[0] == '$' {
+		if v, ok, err := convertExtJSONWrapper(doc); ok || err != nil {
+			return v, err
+		}
+	}
+	return doc, nil
+}
+
+// extJSONWrappers is the set of wrapper documents identified by the keys in
+// the document joined with "+".
+var extJSONWrappers = map[string]bool{
+	"$oid":               true,
+	"$symbol":            true,
+	"$numberInt":         true,
+	"$numberLong":        true,
+	"$numberDouble":      true,
+	"$numberDecimal":     true,
+	"$binary":            true,
+	"$binary+$type":      true,
+	"$type+$binary":      true,
+	"$code":              true,
+	"$code+$scope":       true,
+	"$scope+$code":       true,
+	"$timestamp":         true,
+	"$regularExpression": true,
+	"$regex+$options":    true,
+	"$options+$regex":    true,
+	"$dbPointer":         true,
+	"$date":              true,
+	"$minKey":            true,
+	"$maxKey":            true,
+	"$undefined":         true,
+}
+
+// get returns the value for key in the document.
+func (d D) get(key string) (interface{}, bool) {
+	for _, item := range d {
+		if item.Key == key {
+			return item.Value, true
+		}
+	}
+	return nil, false
+}
+
+// convertExtJSONWrapper converts a wrapper document to the corresponding Go
+// value. If the document is not a wrapper, then ok is false.
+func convertExtJSONWrapper(doc D) (v interface{}, ok bool, err error) {
+	keys := make([]string, len(doc))
+	for i, item := range doc {
+		keys[i] = item.Key
+	}
+	name := strings.Join(keys, "+")
+	if !extJSONWrappers[name] {
+		return nil, false, nil
+	}
+
+	invalid := func() (interface{}, bool, error) {
+		return nil, true, errors.New("bson: invalid extended JSON " + keys[0] + " value")
+	}
+	str := func(key string) (string, bool) {
+		v, _ := doc.get(key)
+		s, ok := v.(string)
+		return s, ok
+	}
+	sub := func(key string) (D, bool) {
+		v, _ := doc.get(key)
+		d, ok := v.(D)
+		return d, ok
+	}
+
+	switch name {
+	case "$oid":
+		s, ok := str("$oid")
+		if !ok {
+			return invalid()
+		}
+		id, err := NewObjectIdHex(s)
+		if err != nil {
+			return invalid()
+		}
+		return id, true, nil
+	case "$symbol":
+		s, ok := str("$symbol")
+		if !ok {
+			return invalid()
+		}
+		return Symbol(s), true, nil
+	case "$numberInt":
+		s, _ := str("$numberInt")
+		n, err := strconv.ParseInt(s, 10, 32)
+		if err != nil {
+			return invalid()
+		}
+		return int32(n), true, nil
+	case "$numberLong":
+		s, _ := str("$numberLong")
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return invalid()
+		}
+		return n, true, nil
+	case "$numberDouble":
+		s, _ := str("$numberDouble")
+		f, err := parseExtJSONFloat(s)
+		if err != nil {
+			return invalid()
+		}
+		return f, true, nil
+	case "$numberDecimal":
+		s, _ := str("$numberDecimal")
+		d, err := ParseDecimal128(s)
+		if err != nil {
+			return invalid()
+		}
+		return d, true, nil
+	case "$binary", "$binary+$type", "$type+$binary":
+		var data, subtype string
+		if b, ok := sub("$binary"); ok && name == "$binary" {
+			bv, _ := b.get("base64")
+			sv, _ := b.get("subType")
+			data, _ = bv.(string)
+			subtype, _ = sv.(string)
+		} else {
+			data, _ = str("$binary")
+			subtype, _ = str("$type")
+		}
+		p, err := base64.StdEncoding.DecodeString(data)
+		if err != nil || len(subtype) == 0 || len(subtype) > 2 {
+			return invalid()
+		}
+		st, err := strconv.ParseUint(subtype, 16, 8)
+		if err != nil {
+			return invalid()
+		}
+		return Binary{Subtype: byte(st), Data: p}, true, nil
+	case "$code":
+		s, ok := str("$code")
+		if !ok {
+			return invalid()
+		}
+		return Code(s), true, nil
+	case "$code+$scope", "$scope+$code":
+		s, ok := str("$code")
+		scope, ok2 := sub("$scope")
+		if !ok || !ok2 {
+			return invalid()
+		}
+		m := make(map[string]interface{}, len(scope))
+		for _, item := range scope {
+			m[item.Key] = item.Value
+		}
+		return CodeWithScope{Code: s, Scope: m}, true, nil
+	case "$timestamp":
+		ts, ok := sub("$timestamp")
+		if !ok {
+			return invalid()
+		}
+		tv, _ := ts.get("t")
+		iv, _ := ts.get("i")
+		t, ok := extJSONUint32(tv)
+		i, ok2 := extJSONUint32(iv)
+		if !ok || !ok2 {
+			return invalid()
+		}
+		return Timestamp(int64(t)<<32 | int64(i)), true, nil
+	case "$regularExpression":
+		r, ok := sub("$regularExpression")
+		if !ok {
+			return invalid()
+		}
+		pv, _ := r.get("pattern")
+		ov, _ := r.get("options")
+		pattern, ok := pv.(string)
+		options, ok2 := ov.(string)
+		if !ok || !ok2 {
+			return invalid()
+		}
+		return Regexp{Pattern: pattern, Options: options}, true, nil
+	case "$regex+$options", "$options+$regex":
+		pattern, ok := str("$regex")
+		options, ok2 := str("$options")
+		if !ok || !ok2 {
+			// The $regex query operator.
+			return nil, false, nil
+		}
+		return Regexp{Pattern: pattern, Options: options}, true, nil
+	case "$dbPointer":
+		p, ok := sub("$dbPointer")
+		if !ok {
+			return invalid()
+		}
+		rv, _ := p.get("$ref")
+		iv, _ := p.get("$id")
+		ns, ok := rv.(string)
+		id, ok2 := iv.(ObjectId)
+		if !ok || !ok2 {
+			return invalid()
+		}
+		return DBPointer{Namespace: ns, Id: id}, true, nil
+	case "$date":
+		v, _ := doc.get("$date")
+		switch v := v.(type) {
+		case string:
+			t, err := time.Parse(time.RFC3339Nano, v)
+			if err != nil {
+				t, err = time.Parse("2006-01-02T15:04:05.999999999Z0700", v)
+			}
+			if err != nil {
+				return invalid()
+			}
+			return t.In(time.UTC), true, nil
+		case int64:
+			return timeFromMS(v), true, nil
+		case int32:
+			return timeFromMS(int64(v)), true, nil
+		}
+		return invalid()
+	case "$minKey", "$maxKey":
+		if v, _ := doc.get(name); v != int32(1) {
+			return invalid()
+		}
+		if name == "$minKey" {
+			return MinValue, true, nil
+		}
+		return MaxValue, true, nil
+	case "$undefined":
+		if v, _ := doc.get(name); v != true {
+			return invalid()
+		}
+		return Undefined{}, true, nil
+	}
+	return nil, false, nil
+}
+
+func parseExtJSONFloat(s string) (float64, error) {
+	switch s {
+	case "Infinity":
+		return math.Inf(1), nil
+	case "-Infinity":
+		return math.Inf(-1), nil
+	case "NaN":
+		return math.NaN(), nil
+	}
+	return strconv.ParseFloat(s, 64)
+}
+
+func extJSONUint32(v interface{}) (uint32, bool) {
+	switch v := v.(type) {
+	case int32:
+		if v >= 0 {
+			return uint32(v), true
+		}
+	case int64:
+		if v >= 0 && v <= math.MaxUint32 {
+			return uint32(v), true
+		}
+	}
+	return 0, false
+}
+
+// ExtJSONString returns the relaxed Extended JSON representation of the
+// document in data, or a description of the error if the document cannot be
+// converted. The function is intended for logging.
+func ExtJSONString(data []byte) string {
+	p, err := ToExtJSON(data, ExtJSONRelaxed)
+	if err != nil {
+		return "<invalid BSON: " + err.Error() + ">"
+	}
+	return string(p)
+}
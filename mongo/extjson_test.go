@@ -0,0 +1,151 @@
+// Copyright 2011 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package mongo
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+var extJSONTests = []struct {
+	v         interface{}
+	canonical string
+	relaxed   string
+	shell     string
+}{
+	{1.0, `{"$numberDouble":"1.0"}`, `1.0`, `1.0`},
+	{-0.5, `{"$numberDouble":"-0.5"}`, `-0.5`, `-0.5`},
+	{1e300, `{"$numberDouble":"1E+300"}`, `1E+300`, `1E+300`},
+	// Double cases from the BSON corpus.
+	{1.0001220703125, `{"$numberDouble":"1.0001220703125"}`, `1.0001220703125`, `1.0001220703125`},
+	{-1.0001220703125, `{"$numberDouble":"-1.0001220703125"}`, `-1.0001220703125`, `-1.0001220703125`},
+	{1.2345678921232e18, `{"$numberDouble":"1.2345678921232E+18"}`, `1.2345678921232E+18`, `1.2345678921232E+18`},
+	{-1.2345678921232e18, `{"$numberDouble":"-1.2345678921232E+18"}`, `-1.2345678921232E+18`, `-1.2345678921232E+18`},
+	{0.0, `{"$numberDouble":"0.0"}`, `0.0`, `0.0`},
+	{math.Copysign(0, -1), `{"$numberDouble":"-0.0"}`, `-0.0`, `-0.0`},
+	{1234567.0, `{"$numberDouble":"1234567.0"}`, `1234567.0`, `1234567.0`},
+	{1e-5, `{"$numberDouble":"1E-05"}`, `1E-05`, `1E-05`},
+	{math.Inf(-1), `{"$numberDouble":"-Infinity"}`, `{"$numberDouble":"-Infinity"}`, `-Infinity`},
+	{"a\"\n<", `"a\"\n<"`, `"a\"\n<"`, `"a\"\n<"`},
+	{D{{"b", true}, {"a", nil}}, `{"b":true}`, `{"b":true}`, `{"b":true}`},
+	{BSONData{Kind: KindNull}, `null`, `null`, `null`},
+	{A{int32(1), "x"}, `[{"$numberInt":"1"},"x"]`, `[1,"x"]`, `[1,"x"]`},
+	{Binary{BinaryUUID, []byte{0xff, 0xfe}}, `{"$binary":{"base64":"//4=","subType":"04"}}`, `{"$binary":{"base64":"//4=","subType":"04"}}`, `BinData(4,"//4=")`},
+	{Undefined{}, `{"$undefined":true}`, `{"$undefined":true}`, `undefined`},
+	{ObjectId("\x57\xe1\x93\xd7\xa9\xcc\x81\xb4\x02\x74\x98\xb5"), `{"$oid":"57e193d7a9cc81b4027498b5"}`, `{"$oid":"57e193d7a9cc81b4027498b5"}`, `ObjectId("57e193d7a9cc81b4027498b5")`},
+	{time.Date(2012, 12, 24, 12, 15, 30, 501e6, time.UTC), `{"$date":{"$numberLong":"1356351330501"}}`, `{"$date":"2012-12-24T12:15:30.501Z"}`, `ISODate("2012-12-24T12:15:30.501Z")`},
+	{time.Unix(-1, 0), `{"$date":{"$numberLong":"-1000"}}`, `{"$date":{"$numberLong":"-1000"}}`, `ISODate("1969-12-31T23:59:59Z")`},
+	{Regexp{"a/b", "i"}, `{"$regularExpression":{"pattern":"a/b","options":"i"}}`, `{"$regularExpression":{"pattern":"a/b","options":"i"}}`, `/a/b/i`},
+	{DBPointer{"db.c", ObjectId("\x57\xe1\x93\xd7\xa9\xcc\x81\xb4\x02\x74\x98\xb5")}, `{"$dbPointer":{"$ref":"db.c","$id":{"$oid":"57e193d7a9cc81b4027498b5"}}}`, `{"$dbPointer":{"$ref":"db.c","$id":{"$oid":"57e193d7a9cc81b4027498b5"}}}`, `DBPointer("db.c", ObjectId("57e193d7a9cc81b4027498b5"))`},
+	{Code("x()"), `{"$code":"x()"}`, `{"$code":"x()"}`, `{"$code":"x()"}`},
+	{CodeWithScope{"x", map[string]interface{}{"y": "z"}}, `{"$code":"x","$scope":{"y":"z"}}`, `{"$code":"x","$scope":{"y":"z"}}`, `{"$code":"x","$scope":{"y":"z"}}`},
+	{Symbol("s"), `{"$symbol":"s"}`, `{"$symbol":"s"}`, `"s"`},
+	{Timestamp(123<<32 | 456), `{"$timestamp":{"t":123,"i":456}}`, `{"$timestamp":{"t":123,"i":456}}`, `Timestamp(123, 456)`},
+	{int64(-42), `{"$numberLong":"-42"}`, `-42`, `NumberLong(-42)`},
+	{int64(1 << 60), `{"$numberLong":"1152921504606846976"}`, `1152921504606846976`, `NumberLong("1152921504606846976")`},
+	{NewDecimal128(0x303e000000000000, 1), `{"$numberDecimal":"0.1"}`, `{"$numberDecimal":"0.1"}`, `NumberDecimal("0.1")`},
+	{MinValue, `{"$minKey":1}`, `{"$minKey":1}`, `MinKey`},
+	{MaxValue, `{"$maxKey":1}`, `{"$maxKey":1}`, `MaxKey`},
+}
+
+func TestToExtJSON(t *testing.T) {
+	for _, tt := range extJSONTests {
+		data, err := Encode(nil, D{{"v", tt.v}})
+		if err != nil {
+			t.Errorf("Encode(%v) returned error %v", tt.v, err)
+			continue
+		}
+		for _, m := range []struct {
+			mode     ExtJSONMode
+			expected string
+		}{
+			{ExtJSONCanonical, tt.canonical},
+			{ExtJSONRelaxed, tt.relaxed},
+			{ExtJSONShell, tt.shell},
+		} {
+			p, err := ToExtJSON(data, m.mode)
+			if err != nil {
+				t.Errorf("ToExtJSON(%v, %d) returned error %v", tt.v, m.mode, err)
+				continue
+			}
+			if expected := `{"v":` + m.expected + `}`; string(p) != expected {
+				t.Errorf("ToExtJSON(%v, %d) = %s, want %s", tt.v, m.mode, p, expected)
+			}
+		}
+	}
+}
+
+func TestFromExtJSON(t *testing.T) {
+	for _, tt := range extJSONTests {
+		expected, _ := Encode(nil, D{{"v", tt.v}})
+		data, err := FromExtJSON([]byte(`{"v":` + tt.canonical + `}`))
+		if err != nil {
+			t.Errorf("FromExtJSON(%s) returned error %v", tt.canonical, err)
+			continue
+		}
+		if string(data) != string(expected) {
+			t.Errorf("FromExtJSON(%s) = %q, want %q", tt.canonical, data, expected)
+		}
+	}
+}
+
+var fromExtJSONTests = []struct {
+	json     string
+	expected D
+}{
+	{`{"b":1,"a":2.5,"c":9999999999}`, D{{"b", int32(1)}, {"a", 2.5}, {"c", int64(9999999999)}}},
+	{`{"d":{"$date":"2012-12-24T12:15:30.501Z"}}`, D{{"d", time.Date(2012, 12, 24, 12, 15, 30, 501e6, time.UTC)}}},
+	{`{"d":{"$date":1356351330501}}`, D{{"d", time.Date(2012, 12, 24, 12, 15, 30, 501e6, time.UTC)}}},
+	{`{"d":{"$date":"2012-12-24T13:15:30.501+0100"}}`, D{{"d", time.Date(2012, 12, 24, 12, 15, 30, 501e6, time.UTC)}}},
+	{`{"b":{"$type":"80","$binary":"//4="}}`, D{{"b", Binary{BinaryUserDefined, []byte{0xff, 0xfe}}}}},
+	{`{"r":{"$regex":"^a","$options":"m"}}`, D{{"r", Regexp{"^a", "m"}}}},
+	{`{"q":{"$regex":"^a"}}`, D{{"q", D{{"$regex", "^a"}}}}},
+	{`{"q":{"$in":[1,2]}}`, D{{"q", D{{"$in", A{int32(1), int32(2)}}}}}},
+	{`{"e":{}, "a":[]}`, D{{"e", D{}}, {"a", A{}}}},
+}
+
+func TestFromExtJSONLegacy(t *testing.T) {
+	for _, tt := range fromExtJSONTests {
+		expected, _ := Encode(nil, tt.expected)
+		data, err := FromExtJSON([]byte(tt.json))
+		if err != nil {
+			t.Errorf("FromExtJSON(%s) returned error %v", tt.json, err)
+			continue
+		}
+		if string(data) != string(expected) {
+			t.Errorf("FromExtJSON(%s) = %q, want %q", tt.json, data, expected)
+		}
+	}
+}
+
+func TestFromExtJSONErrors(t *testing.T) {
+	for _, s := range []string{
+		`[]`,
+		`{"a":1} {}`,
+		`{"a":`,
+		`{"a":{"$oid":"xyz"}}`,
+		`{"a":{"$numberInt":"1.5"}}`,
+		`{"a":{"$numberLong":1}}`,
+		`{"a":{"$binary":{"base64":"!","subType":"00"}}}`,
+		`{"a":{"$timestamp":{"t":-1,"i":0}}}`,
+		`{"a":{"$date":"yesterday"}}`,
+		`{"a":{"$minKey":2}}`,
+	} {
+		if _, err := FromExtJSON([]byte(s)); err == nil {
+			t.Errorf("FromExtJSON(%s) did not return error", s)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+// Copyright 2011 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package mongo
+
+import "iter"
+
+// Documents returns an iterator over the documents in cursor c. Each document
+// is decoded to a value of type T. The iterator closes the cursor when the
+// loop completes or exits early:
+//
+//	cursor, err := c.Find(nil).Cursor()
+//	if err != nil {
+//	    return err
+//	}
+//	for doc, err := range mongo.Documents[Doc](cursor) {
+//	    if err != nil {
+//	        return err
+//	    }
+//	    // Do something with doc.
+//	}
+//
+// If a document cannot be converted to T, then the iterator yields the
+// partially decoded value with the error and continues with the next
+// document. The iterator stops after yielding a permanent cursor error.
+func Documents[T any](c Cursor) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		defer c.Close()
+		for c.HasNext() {
+			var v T
+			err := c.Next(&v)
+			if !yield(v, err) {
+				return
+			}
+			if err != nil && c.Err() != nil {
+				return
+			}
+		}
+	}
+}
+
+// All executes the query and returns the entire result set as a slice of
+// values of type T.
+func All[T any](q *Query) ([]T, error) {
+	cursor, err := q.Cursor()
+	if err != nil {
+		return nil, err
+	}
+	result := make([]T, 0)
+	for v, err := range Documents[T](cursor) {
+		if err != nil {
+			return result, err
+		}
+		result = append(result, v)
+	}
+	return result, nil
+}
+
+// One executes the query and returns the first result. If the query does not
+// match a document, then One returns Done.
+func One[T any](q *Query) (T, error) {
+	var v T
+	err := q.One(&v)
+	return v, err
+}
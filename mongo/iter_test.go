@@ -0,0 +1,165 @@
+// Copyright 2011 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package mongo
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// sliceCursor is a cursor over a slice of documents.
+type sliceCursor struct {
+	docs   []interface{}
+	err    error
+	closed bool
+}
+
+func (r *sliceCursor) Close() error {
+	r.closed = true
+	if r.err == nil {
+		r.err = errors.New("closed")
+	}
+	return nil
+}
+
+func (r *sliceCursor) Err() error { return r.err }
+
+func (r *sliceCursor) HasNext() bool {
+	if r.err != nil {
+		return r.err != Done
+	}
+	if len(r.docs) == 0 {
+		r.err = Done
+		return false
+	}
+	return true
+}
+
+func (r *sliceCursor) Next(value interface{}) error {
+	if !r.HasNext() {
+		return Done
+	}
+	if r.err != nil {
+		return r.err
+	}
+	data, err := Encode(nil, r.docs[0])
+	r.docs = r.docs[1:]
+	if err != nil {
+		return err
+	}
+	return Decode(data, value)
+}
+
+func (r *sliceCursor) NextBatch() ([][]byte, error) {
+	var batch [][]byte
+	for r.HasNext() {
+		var bd BSONData
+		if err := r.Next(&bd); err != nil {
+			return batch, err
+		}
+		batch = append(batch, bd.Data)
+	}
+	return batch, nil
+}
+
+func (r *sliceCursor) RemainingBatchLength() int { return len(r.docs) }
+func (r *sliceCursor) ID() int64                 { return 0 }
+
+type sliceConn struct {
+	fakeConn
+	cursor *sliceCursor
+}
+
+func (c *sliceConn) Find(namespace string, query interface{}, options *FindOptions) (Cursor, error) {
+	return c.cursor, nil
+}
+
+type iterDoc struct {
+	X int `bson:"x"`
+}
+
+func TestDocuments(t *testing.T) {
+	r := &sliceCursor{docs: []interface{}{M{"x": 1}, M{"x": "bad"}, M{"x": 3}}}
+	var xs []int
+	var errs int
+	for doc, err := range Documents[iterDoc](r) {
+		if err != nil {
+			errs += 1
+			continue
+		}
+		xs = append(xs, doc.X)
+	}
+	if !reflect.DeepEqual(xs, []int{1, 3}) || errs != 1 {
+		t.Errorf("results = %v with %d errors, want [1 3] with 1 error", xs, errs)
+	}
+	if !r.closed {
+		t.Error("cursor not closed")
+	}
+}
+
+func TestDocumentsBreak(t *testing.T) {
+	r := &sliceCursor{docs: []interface{}{M{"x": 1}, M{"x": 2}}}
+	for doc := range Documents[M](r) {
+		if doc["x"] != 1 {
+			t.Errorf("doc = %v, want x: 1", doc)
+		}
+		break
+	}
+	if !r.closed {
+		t.Error("cursor not closed after break")
+	}
+}
+
+func TestDocumentsFatal(t *testing.T) {
+	r := &sliceCursor{docs: []interface{}{M{"x": 1}}, err: errors.New("network")}
+	n := 0
+	for _, err := range Documents[iterDoc](r) {
+		n += 1
+		if err == nil || err.Error() != "network" {
+			t.Errorf("err = %v, want network", err)
+		}
+	}
+	if n != 1 {
+		t.Errorf("iterator yielded %d times, want 1", n)
+	}
+}
+
+func TestAllOne(t *testing.T) {
+	c := &sliceConn{cursor: &sliceCursor{docs: []interface{}{M{"x": 1}, M{"x": 2}}}}
+	q := Collection{Conn: c, Namespace: "db.coll"}.Find(nil)
+	docs, err := All[iterDoc](q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []iterDoc{{1}, {2}}; !reflect.DeepEqual(docs, expected) {
+		t.Errorf("All() = %v, want %v", docs, expected)
+	}
+
+	c.cursor = &sliceCursor{docs: []interface{}{M{"x": 5}}}
+	doc, err := One[*iterDoc](q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc == nil || doc.X != 5 {
+		t.Errorf("One() = %v, want &{5}", doc)
+	}
+
+	c.cursor = &sliceCursor{}
+	_, err = One[iterDoc](q)
+	if err != Done {
+		t.Errorf("One() on empty result returned %v, want Done", err)
+	}
+}
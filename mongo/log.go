@@ -149,3 +149,9 @@ func (r *logCursor) Next(value interface{}) error {
 	r.log.Printf("%sNext() (%v, %v)", r.prefix, m, err)
 	return err
 }
+
+func (r *logCursor) NextBatch() ([][]byte, error) {
+	batch, err := r.Cursor.NextBatch()
+	r.log.Printf("%sNextBatch() (%d documents, %v)", r.prefix, len(batch), err)
+	return batch, err
+}
@@ -0,0 +1,223 @@
+// Copyright 2011 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package mongo
+
+import (
+	"encoding"
+	"errors"
+	"reflect"
+	"sync"
+)
+
+// Marshaler is the interface implemented by types that can encode themselves
+// to a BSON value. MarshalBSONValue returns the kind of the value and the
+// encoding of the value without the element kind and name. If the kind is
+// zero, then the element is omitted from the document.
+type Marshaler interface {
+	MarshalBSONValue() (kind int, data []byte, err error)
+}
+
+// Unmarshaler is the interface implemented by types that can decode a BSON
+// value of themselves. The data argument is the encoding of the value without
+// the element kind and name. UnmarshalBSONValue must copy the data if it
+// wishes to retain the data after returning.
+type Unmarshaler interface {
+	UnmarshalBSONValue(kind int, data []byte) error
+}
+
+// DocumentMarshaler is the interface implemented by types that can encode
+// themselves to a BSON document. The bsongen command generates implementations
+// of DocumentMarshaler and DocumentUnmarshaler for struct types.
+type DocumentMarshaler interface {
+	MarshalBSON() ([]byte, error)
+}
+
+// DocumentUnmarshaler is the interface implemented by types that can decode a
+// BSON document of themselves. UnmarshalBSON must copy the data if it wishes
+// to retain the data after returning.
+type DocumentUnmarshaler interface {
+	UnmarshalBSON(data []byte) error
+}
+
+// MarshalerError is returned by Encode when a Marshaler or DocumentMarshaler
+// returns an error.
+type MarshalerError struct {
+	Type reflect.Type
+	Err  error
+}
+
+func (e *MarshalerError) Error() string {
+	return "bson: error calling marshal method for type " + e.Type.String() + ": " + e.Err.Error()
+}
+
+var (
+	typeMarshaler           = reflect.TypeOf(new(Marshaler)).Elem()
+	typeUnmarshaler         = reflect.TypeOf(new(Unmarshaler)).Elem()
+	typeDocumentMarshaler   = reflect.TypeOf(new(DocumentMarshaler)).Elem()
+	typeDocumentUnmarshaler = reflect.TypeOf(new(DocumentUnmarshaler)).Elem()
+	typeTextMarshaler       = reflect.TypeOf(new(encoding.TextMarshaler)).Elem()
+	typeTextUnmarshaler     = reflect.TypeOf(new(encoding.TextUnmarshaler)).Elem()
+)
+
+var (
+	marshalerMutex        sync.RWMutex
+	marshalerEncoderCache = make(map[reflect.Type]encoderFunc)
+	marshalerDecoderCache = make(map[reflect.Type]decoderFunc)
+)
+
+// marshalerEncoder returns the encoder for types that implement Marshaler or
+// DocumentMarshaler. If the type does not implement the interfaces, then nil
+// is returned.
+func marshalerEncoder(t reflect.Type) encoderFunc {
+	marshalerMutex.RLock()
+	encoder, found := marshalerEncoderCache[t]
+	marshalerMutex.RUnlock()
+	if found {
+		return encoder
+	}
+
+	switch {
+	case t.Kind() != reflect.Ptr && t.Implements(typeNullable):
+		// Pointers to Nullable are dereferenced by the pointer encoder.
+		encoder = encodeNullable
+	case t.Implements(typeMarshaler):
+		encoder = encodeMarshaler
+	case t.Implements(typeDocumentMarshaler):
+		encoder = encodeDocumentMarshaler
+	case t.Kind() != reflect.Ptr && reflect.PtrTo(t).Implements(typeMarshaler):
+		encoder = addrEncoder(t, encodeMarshaler)
+	case t.Kind() != reflect.Ptr && reflect.PtrTo(t).Implements(typeDocumentMarshaler):
+		encoder = addrEncoder(t, encodeDocumentMarshaler)
+	}
+
+	marshalerMutex.Lock()
+	marshalerEncoderCache[t] = encoder
+	marshalerMutex.Unlock()
+	return encoder
+}
+
+// addrEncoder returns an encoder for types where the marshal method has a
+// pointer receiver. The method is called if the value is addressable.
+// Otherwise, the value is encoded using the encoder for the value's kind.
+func addrEncoder(t reflect.Type, encoder encoderFunc) encoderFunc {
+	return func(e *encodeState, name string, fs *fieldSpec, v reflect.Value) {
+		if v.CanAddr() {
+			encoder(e, name, fs, v.Addr())
+			return
+		}
+		kindEncoder, found := kindEncoder[t.Kind()]
+		if !found {
+			abort(&EncodeTypeError{t})
+		}
+		kindEncoder(e, name, fs, v)
+	}
+}
+
+func encodeMarshaler(e *encodeState, name string, fs *fieldSpec, v reflect.Value) {
+	if v.Kind() == reflect.Ptr && v.IsNil() {
+		return
+	}
+	if fs.omitEmpty && v.IsZero() {
+		return
+	}
+	kind, data, err := v.Interface().(Marshaler).MarshalBSONValue()
+	if err == nil && kind != 0 {
+		err = checkMarshalerData(kind, data)
+	}
+	if err != nil {
+		abort(&MarshalerError{v.Type(), err})
+	}
+	if kind == 0 {
+		return
+	}
+	e.writeKindName(kind, name)
+	e.Write(data)
+}
+
+func encodeDocumentMarshaler(e *encodeState, name string, fs *fieldSpec, v reflect.Value) {
+	if v.Kind() == reflect.Ptr && v.IsNil() {
+		return
+	}
+	if fs.omitEmpty && v.IsZero() {
+		return
+	}
+	data, err := v.Interface().(DocumentMarshaler).MarshalBSON()
+	if err == nil {
+		err = checkMarshalerData(KindDocument, data)
+	}
+	if err != nil {
+		abort(&MarshalerError{v.Type(), err})
+	}
+	e.writeKindName(KindDocument, name)
+	e.Write(data)
+}
+
+// checkMarshalerData returns an error if the length of data does not match
+// the encoding of a value with the given kind. The contents of documents and
+// arrays are not validated.
+func checkMarshalerData(kind int, data []byte) (err error) {
+	defer handleAbort(&err)
+	d := decodeState{data: data}
+	d.skipValue(kind)
+	if d.offset != len(data) ||
+		(kind == KindDocument || kind == KindArray) && (len(data) < 5 || data[len(data)-1] != 0) {
+		return errors.New("invalid " + kindName(kind) + " length")
+	}
+	return nil
+}
+
+// marshalerDecoder returns the decoder for types where a pointer to the type
+// implements Unmarshaler or DocumentUnmarshaler. If the type does not
+// implement the interfaces, then nil is returned.
+func marshalerDecoder(t reflect.Type) decoderFunc {
+	marshalerMutex.RLock()
+	decoder, found := marshalerDecoderCache[t]
+	marshalerMutex.RUnlock()
+	if found {
+		return decoder
+	}
+
+	switch pt := reflect.PtrTo(t); {
+	case t.Implements(typeNullable):
+		decoder = decodeNullable
+	case pt.Implements(typeUnmarshaler):
+		decoder = decodeUnmarshaler
+	case pt.Implements(typeDocumentUnmarshaler):
+		decoder = decodeDocumentUnmarshaler
+	}
+
+	marshalerMutex.Lock()
+	marshalerDecoderCache[t] = decoder
+	marshalerMutex.Unlock()
+	return decoder
+}
+
+func decodeUnmarshaler(d *decodeState, kind int, v reflect.Value) {
+	p := d.scanValue(kind)
+	if err := v.Addr().Interface().(Unmarshaler).UnmarshalBSONValue(kind, p); err != nil {
+		d.saveError(err)
+	}
+}
+
+func decodeDocumentUnmarshaler(d *decodeState, kind int, v reflect.Value) {
+	if kind != KindDocument {
+		d.saveErrorAndSkip(kind, v.Type())
+		return
+	}
+	p := d.scanValue(kind)
+	if err := v.Addr().Interface().(DocumentUnmarshaler).UnmarshalBSON(p); err != nil {
+		d.saveError(err)
+	}
+}
@@ -0,0 +1,244 @@
+// Copyright 2011 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package mongo
+
+import (
+	"errors"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+// testCents encodes as a string with two decimal places.
+type testCents int64
+
+func (c testCents) MarshalBSONValue() (int, []byte, error) {
+	s := strconv.FormatFloat(float64(c)/100, 'f', 2, 64)
+	data, err := Encode(nil, D{{"s", s}})
+	if err != nil {
+		return 0, nil, err
+	}
+	var bd struct {
+		S BSONData `bson:"s"`
+	}
+	if err := Decode(data, &bd); err != nil {
+		return 0, nil, err
+	}
+	return bd.S.Kind, bd.S.Data, nil
+}
+
+func (c *testCents) UnmarshalBSONValue(kind int, data []byte) error {
+	var s string
+	if err := (BSONData{kind, data}).Decode(&s); err != nil {
+		return err
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return err
+	}
+	*c = testCents(f*100 + 0.5)
+	return nil
+}
+
+// testColor is an enum with pointer receiver methods.
+type testColor int
+
+func (c *testColor) MarshalBSONValue() (int, []byte, error) {
+	return KindInt32, []byte{byte(*c + 10), 0, 0, 0}, nil
+}
+
+func (c *testColor) UnmarshalBSONValue(kind int, data []byte) error {
+	if kind != KindInt32 || len(data) != 4 {
+		return errors.New("bad color")
+	}
+	*c = testColor(data[0] - 10)
+	return nil
+}
+
+// testPoint encodes as a GeoJSON point document.
+type testPoint struct {
+	Lng, Lat float64
+}
+
+func (p testPoint) MarshalBSON() ([]byte, error) {
+	return Encode(nil, D{{"type", "Point"}, {"coordinates", []float64{p.Lng, p.Lat}}})
+}
+
+func (p *testPoint) UnmarshalBSON(data []byte) error {
+	var v struct {
+		Type        string    `bson:"type"`
+		Coordinates []float64 `bson:"coordinates"`
+	}
+	if err := Decode(data, &v); err != nil {
+		return err
+	}
+	if v.Type != "Point" || len(v.Coordinates) != 2 {
+		return errors.New("bad point")
+	}
+	p.Lng, p.Lat = v.Coordinates[0], v.Coordinates[1]
+	return nil
+}
+
+type testMarshalDoc struct {
+	Price  testCents            `bson:"price"`
+	Color  testColor            `bson:"color"`
+	Where  testPoint            `bson:"where"`
+	Ptr    *testPoint           `bson:"ptr,omitempty"`
+	Prices []testCents          `bson:"prices"`
+	ByName map[string]testCents `bson:"byName"`
+	Zero   testCents            `bson:"zero,omitempty"`
+}
+
+func TestMarshaler(t *testing.T) {
+	doc := &testMarshalDoc{
+		Price:  1234,
+		Color:  1,
+		Where:  testPoint{1.5, 2.5},
+		Prices: []testCents{1, 200},
+		ByName: map[string]testCents{"a": 99},
+	}
+	data, err := Encode(nil, doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var m M
+	if err := Decode(data, &m); err != nil {
+		t.Fatal(err)
+	}
+	expected := M{
+		"price":  "12.34",
+		"color":  11,
+		"where":  map[string]interface{}{"type": "Point", "coordinates": []interface{}{1.5, 2.5}},
+		"prices": []interface{}{"0.01", "2.00"},
+		"byName": map[string]interface{}{"a": "0.99"},
+	}
+	if !reflect.DeepEqual(m, expected) {
+		t.Errorf("encoded %v, want %v", m, expected)
+	}
+
+	var doc2 testMarshalDoc
+	if err := Decode(data, &doc2); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(&doc2, doc) {
+		t.Errorf("decoded %+v, want %+v", doc2, doc)
+	}
+}
+
+func TestMarshalerNotAddressable(t *testing.T) {
+	// The pointer receiver method is not called for values stored in a map.
+	data, err := Encode(nil, M{"color": testColor(1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m M
+	if err := Decode(data, &m); err != nil {
+		t.Fatal(err)
+	}
+	if m["color"] != 1 {
+		t.Errorf("color = %v, want 1", m["color"])
+	}
+}
+
+func TestDocumentMarshalerTopLevel(t *testing.T) {
+	data, err := Encode(nil, testPoint{3, 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var p testPoint
+	if err := Decode(data, &p); err != nil {
+		t.Fatal(err)
+	}
+	if p != (testPoint{3, 4}) {
+		t.Errorf("decoded %v, want {3 4}", p)
+	}
+}
+
+type testBadMarshaler struct{}
+
+func (testBadMarshaler) MarshalBSONValue() (int, []byte, error) {
+	return 0, nil, errors.New("test")
+}
+
+// testRawMarshaler returns the encoding in its fields.
+type testRawMarshaler struct {
+	kind int
+	data []byte
+}
+
+func (m testRawMarshaler) MarshalBSONValue() (int, []byte, error) {
+	return m.kind, m.data, nil
+}
+
+// testRawDocMarshaler returns its value as the document encoding.
+type testRawDocMarshaler []byte
+
+func (m testRawDocMarshaler) MarshalBSON() ([]byte, error) {
+	return m, nil
+}
+
+func TestMarshalerInvalidData(t *testing.T) {
+	doc := []byte("\x05\x00\x00\x00\x00")
+	for _, v := range []interface{}{
+		testRawMarshaler{KindInt32, []byte{1, 2, 3}},
+		testRawMarshaler{KindString, []byte("\x05\x00\x00\x00ab\x00")},
+		testRawMarshaler{KindDocument, []byte("\x06\x00\x00\x00\x00")},
+		testRawMarshaler{KindArray, []byte("\x05\x00\x00\x00\x01")},
+		testRawMarshaler{0x42, doc},
+		testRawDocMarshaler("\x06\x00\x00\x00\x00"),
+		testRawDocMarshaler(nil),
+	} {
+		if _, err := Encode(nil, M{"x": v}); err == nil {
+			t.Errorf("Encode(%v) did not return error", v)
+		} else if _, ok := err.(*MarshalerError); !ok {
+			t.Errorf("Encode(%v) returned %v, want *MarshalerError", v, err)
+		}
+		if r, ok := v.(testRawMarshaler); ok && r.kind != KindDocument {
+			continue
+		}
+		if _, err := Encode(nil, v); err == nil {
+			t.Errorf("top-level Encode(%v) did not return error", v)
+		}
+	}
+	for _, v := range []interface{}{
+		testRawMarshaler{KindInt32, []byte{1, 2, 3, 4}},
+		testRawMarshaler{KindString, []byte("\x03\x00\x00\x00ab\x00")},
+		testRawMarshaler{KindDocument, doc},
+		testRawDocMarshaler(doc),
+	} {
+		if _, err := Encode(nil, M{"x": v}); err != nil {
+			t.Errorf("Encode(%v) returned %v", v, err)
+		}
+	}
+	if data, err := Encode(nil, testRawDocMarshaler(doc)); err != nil || string(data) != string(doc) {
+		t.Errorf("top-level Encode = %q, %v, want %q", data, err, doc)
+	}
+}
+
+func TestMarshalerError(t *testing.T) {
+	_, err := Encode(nil, M{"x": testBadMarshaler{}})
+	if _, ok := err.(*MarshalerError); !ok {
+		t.Errorf("Encode returned %v, want *MarshalerError", err)
+	}
+
+	data, _ := Encode(nil, M{"color": "red"})
+	var v struct {
+		Color testColor `bson:"color"`
+	}
+	if err := Decode(data, &v); err == nil || err.Error() != "bad color" {
+		t.Errorf("Decode returned %v, want bad color", err)
+	}
+}
@@ -25,7 +25,10 @@
 // responsible for serializing access to Conn objects.
 package mongo
 
-import "errors"
+import (
+	"errors"
+	"time"
+)
 
 // Cursor has no more results.
 var Done = errors.New("mongo: cursor has no more results")
@@ -93,6 +96,11 @@ type FindOptions struct {
 	// Sets the batch size used for sending documents from the server to the
 	// client.
 	BatchSize int
+
+	// Maximum time that the server waits for new documents before returning
+	// an empty batch to a getMore command on a tailable await cursor. The
+	// option is used by Query.CommandCursor.
+	MaxAwaitTime time.Duration
 }
 
 // A Conn represents a connection to a MongoDB server.
@@ -112,10 +120,13 @@ type Conn interface {
 	// Error returns non-nil if the connection has a permanent error.
 	Err() error
 
-	// Update document specified by selector with update.
+	// Update document specified by selector with update. A
+	// DocumentTooLargeError is returned if the selector or update exceeds
+	// the maximum document size of the server.
 	Update(namespace string, selector, update interface{}, options *UpdateOptions) error
 
-	// Insert documents.
+	// Insert documents. A DocumentTooLargeError is returned if a document
+	// exceeds the maximum document size of the server.
 	Insert(namespace string, options *InsertOptions, documents ...interface{}) error
 
 	// Remove documents specified by selector.
@@ -164,4 +175,18 @@ type Cursor interface {
 	// Next fetches the next document from the cursor. Value must be a map or
 	// a non-nil pointer to struct or map.
 	Next(value interface{}) error
+
+	// NextBatch returns the BSON encoding of the documents remaining in the
+	// current batch. If the current batch is empty, then NextBatch fetches
+	// the next batch from the server. NextBatch returns Done if there are no
+	// more documents to retrieve.
+	NextBatch() ([][]byte, error)
+
+	// RemainingBatchLength returns the number of documents in the current
+	// batch that have not been returned to the application.
+	RemainingBatchLength() int
+
+	// ID returns the server's identifier for the cursor. The identifier is
+	// zero if the server has closed the cursor.
+	ID() int64
 }
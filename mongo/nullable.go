@@ -0,0 +1,82 @@
+// Copyright 2011 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package mongo
+
+import (
+	"reflect"
+)
+
+// Nullable records whether a document element is absent, null or set to a
+// value. Use Nullable for struct fields in PATCH-style updates where an
+// absent field and a null field have different meanings.
+//
+// When decoding, Present is set to true if the element is in the document
+// and Valid is set to true if the element is not null. When encoding, the
+// element is omitted if Present is false and encoded as null if Valid is
+// false. The minsize and truncate field flags apply to Value. The omitempty
+// flag does not apply to a present Nullable.
+type Nullable[T any] struct {
+	Value   T
+	Valid   bool
+	Present bool
+}
+
+// NewNullable returns a present and valid Nullable with value v.
+func NewNullable[T any](v T) Nullable[T] {
+	return Nullable[T]{Value: v, Valid: true, Present: true}
+}
+
+// isNullable marks Nullable types for the encoder and decoder.
+func (n Nullable[T]) isNullable() {}
+
+type nullable interface {
+	isNullable()
+}
+
+var typeNullable = reflect.TypeOf(new(nullable)).Elem()
+
+// The encoder and decoder access the Nullable fields by index.
+const (
+	nullableValue = iota
+	nullableValid
+	nullablePresent
+)
+
+func encodeNullable(e *encodeState, name string, fs *fieldSpec, v reflect.Value) {
+	switch {
+	case !v.Field(nullablePresent).Bool():
+	case !v.Field(nullableValid).Bool():
+		e.writeKindName(KindNull, name)
+	default:
+		// Apply the field's flags to the value, except for omitempty.
+		// A present and valid Nullable is always written.
+		spec := *fs
+		spec.omitEmpty = false
+		spec.nullable = false
+		e.encodeValue(name, &spec, v.Field(nullableValue))
+	}
+}
+
+func decodeNullable(d *decodeState, kind int, v reflect.Value) {
+	v.Field(nullablePresent).SetBool(true)
+	value := v.Field(nullableValue)
+	if kind == KindNull || kind == KindUndefined {
+		v.Field(nullableValid).SetBool(false)
+		value.Set(reflect.Zero(value.Type()))
+		return
+	}
+	v.Field(nullableValid).SetBool(true)
+	d.decodeValue(kind, value)
+}
@@ -0,0 +1,175 @@
+// Copyright 2011 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package mongo
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+type patchDoc struct {
+	Name  Nullable[string] `bson:"name"`
+	Age   Nullable[int]    `bson:"age"`
+	Email Nullable[string] `bson:"email"`
+}
+
+func TestNullable(t *testing.T) {
+	data, _ := Encode(nil, D{{"name", "bob"}, {"age", BSONData{Kind: KindNull}}})
+	var p patchDoc
+	if err := Decode(data, &p); err != nil {
+		t.Fatal(err)
+	}
+	expected := patchDoc{
+		Name: NewNullable("bob"),
+		Age:  Nullable[int]{Present: true},
+	}
+	if p != expected {
+		t.Errorf("Decode() = %+v, want %+v", p, expected)
+	}
+
+	actual, err := Encode(nil, &p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(actual, data) {
+		t.Errorf("Encode(%+v) = %q, want %q", p, actual, data)
+	}
+
+	var a []Nullable[int]
+	data, _ = Encode(nil, D{{"a", A{1, BSONData{Kind: KindNull}}}})
+	var s struct {
+		A *[]Nullable[int] `bson:"a"`
+	}
+	s.A = &a
+	if err := Decode(data, &s); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(a, []Nullable[int]{NewNullable(1), {Present: true}}) {
+		t.Errorf("decoded array %+v", a)
+	}
+}
+
+func TestNullablePointer(t *testing.T) {
+	type doc struct {
+		P *Nullable[string] `bson:"p"`
+		Q *Nullable[string] `bson:"q"`
+		N *Nullable[string] `bson:"n"`
+	}
+	v := doc{P: &Nullable[string]{Value: "x", Valid: true, Present: true}, Q: &Nullable[string]{Present: true}}
+	data, err := Encode(nil, &v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, _ := Encode(nil, D{{"p", "x"}, {"q", BSONData{Kind: KindNull}}})
+	if !bytes.Equal(data, expected) {
+		t.Errorf("Encode(%+v) = %q, want %q", v, data, expected)
+	}
+
+	var v2 doc
+	if err := Decode(data, &v2); err != nil {
+		t.Fatal(err)
+	}
+	if v2.P == nil || *v2.P != *v.P || v2.Q == nil || *v2.Q != *v.Q || v2.N != nil {
+		t.Errorf("Decode() = %+v, want %+v", v2, v)
+	}
+}
+
+func TestNullableFlags(t *testing.T) {
+	type doc struct {
+		N Nullable[int64] `bson:"n,minsize,truncate,omitempty"`
+	}
+	v := doc{N: NewNullable(int64(0))}
+	data, err := Encode(nil, &v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, _ := Encode(nil, D{{"n", int32(0)}})
+	if !bytes.Equal(data, expected) {
+		t.Errorf("Encode(%+v) = %q, want %q", v, data, expected)
+	}
+
+	data, _ = Encode(nil, D{{"n", 1.5}})
+	var v2 doc
+	if err := DecodeWithOptions(data, &v2, &DecodeOptions{StrictPrecision: true}); err != nil {
+		t.Fatal(err)
+	}
+	if v2.N != NewNullable(int64(1)) {
+		t.Errorf("Decode() = %+v, want 1", v2)
+	}
+}
+
+type nullsDoc struct {
+	P *int        `bson:"p"`
+	I interface{} `bson:"i"`
+	S string      `bson:"s"`
+}
+
+func TestPreserveNulls(t *testing.T) {
+	one := 1
+	data, _ := Encode(nil, D{{"p", BSONData{Kind: KindNull}}, {"i", BSONData{Kind: KindNull}}, {"s", BSONData{Kind: KindNull}}})
+
+	v := nullsDoc{P: &one, I: "x", S: "y"}
+	if err := Decode(data, &v); err != nil {
+		t.Fatal(err)
+	}
+	if v.P == nil || v.I == nil || v.S == "" {
+		t.Errorf("Decode() without PreserveNulls = %+v, want fields unchanged", v)
+	}
+
+	if err := DecodeWithOptions(data, &v, &DecodeOptions{PreserveNulls: true}); err != nil {
+		t.Fatal(err)
+	}
+	if v != (nullsDoc{}) {
+		t.Errorf("Decode() with PreserveNulls = %+v, want zero", v)
+	}
+
+	m := M{}
+	if err := DecodeWithOptions(data, m, &DecodeOptions{PreserveNulls: true}); err != nil {
+		t.Fatal(err)
+	}
+	if v, ok := m["p"]; !ok || v != nil || len(m) != 3 {
+		t.Errorf("Decode() with PreserveNulls = %v, want null keys", m)
+	}
+
+	var mp map[string]*int
+	if err := DecodeWithOptions(data, &mp, &DecodeOptions{PreserveNulls: true}); err != nil {
+		t.Fatal(err)
+	}
+	if v, ok := mp["s"]; !ok || v != nil {
+		t.Errorf("Decode() with PreserveNulls = %v, want null keys", mp)
+	}
+}
+
+func TestPreserveNullsMarshaler(t *testing.T) {
+	type doc struct {
+		Where testPoint `bson:"where"`
+		Price testCents `bson:"price"`
+	}
+	data, _ := Encode(nil, D{{"where", BSONData{Kind: KindNull}}})
+	v := doc{Where: testPoint{1, 2}}
+	if err := DecodeWithOptions(data, &v, &DecodeOptions{PreserveNulls: true}); err != nil {
+		t.Fatal(err)
+	}
+	if v.Where != (testPoint{}) {
+		t.Errorf("Decode() with PreserveNulls = %+v, want zero document unmarshaler", v)
+	}
+
+	// Value unmarshalers receive the null element.
+	data, _ = Encode(nil, D{{"price", BSONData{Kind: KindNull}}})
+	if err := DecodeWithOptions(data, &v, &DecodeOptions{PreserveNulls: true}); err == nil {
+		t.Errorf("Decode() with PreserveNulls did not call UnmarshalBSONValue")
+	}
+}
@@ -0,0 +1,235 @@
+// Copyright 2010 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package mongo
+
+import (
+	"crypto/rand"
+	"database/sql/driver"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// ObjectId represents a BSON object identifier.
+//
+// The zero value of ObjectId, NilObjectId, is not a valid object id. Struct
+// fields and map values with the zero value are omitted from BSON encodings.
+type ObjectId string
+
+// NilObjectId is the zero value of ObjectId.
+const NilObjectId ObjectId = ""
+
+// String returns the hexadecimal encoding of id. Use the function
+// NewObjectIdHex to convert the string back to an object id.
+func (id ObjectId) String() string {
+	return hex.EncodeToString([]byte(string(id)))
+}
+
+// Hex returns the hexadecimal encoding of id.
+func (id ObjectId) Hex() string {
+	return id.String()
+}
+
+// IsValid returns true if id has the length of an object id.
+func (id ObjectId) IsValid() bool {
+	return len(id) == 12
+}
+
+// IsZero returns true if id is NilObjectId or the object id with all bytes
+// set to zero.
+func (id ObjectId) IsZero() bool {
+	return id == NilObjectId || id == "\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00"
+}
+
+// MarshalJSON returns the JSON encoding of id.
+func (id ObjectId) MarshalJSON() ([]byte, error) {
+	return json.Marshal(id.String())
+}
+
+// UnmarshalJSON decodes id from JSON to ObjectId.
+func (id *ObjectId) UnmarshalJSON(data []byte) error {
+	if len(data) != 26 || data[0] != '"' || data[25] != '"' {
+		return fmt.Errorf("mongo: invalid ObjectId in JSON: %q", data)
+	}
+	var err error
+	*id, err = NewObjectIdHex(string(data[1:25]))
+	return err
+}
+
+// MarshalText implements the encoding.TextMarshaler interface. The text
+// encoding of an object id is the hexadecimal encoding.
+func (id ObjectId) MarshalText() ([]byte, error) {
+	p := make([]byte, hex.EncodedLen(len(id)))
+	hex.Encode(p, []byte(string(id)))
+	return p, nil
+}
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface. Empty text
+// decodes to NilObjectId.
+func (id *ObjectId) UnmarshalText(text []byte) error {
+	if len(text) == 0 {
+		*id = NilObjectId
+		return nil
+	}
+	oid, err := NewObjectIdHex(string(text))
+	if err != nil {
+		return err
+	}
+	*id = oid
+	return nil
+}
+
+// MarshalBinary implements the encoding.BinaryMarshaler interface. The binary
+// encoding of an object id is the 12 bytes of the object id.
+func (id ObjectId) MarshalBinary() ([]byte, error) {
+	return []byte(string(id)), nil
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface. Empty
+// data decodes to NilObjectId.
+func (id *ObjectId) UnmarshalBinary(data []byte) error {
+	if len(data) != 0 && len(data) != 12 {
+		return errors.New("mongo: bad object id binary len")
+	}
+	*id = ObjectId(data)
+	return nil
+}
+
+// Scan implements the database/sql Scanner interface. The source value can be
+// the hexadecimal encoding or the 12 bytes of an object id. A nil value scans
+// as NilObjectId.
+func (id *ObjectId) Scan(src interface{}) error {
+	var p []byte
+	switch src := src.(type) {
+	case nil:
+		*id = NilObjectId
+		return nil
+	case string:
+		p = []byte(src)
+	case []byte:
+		p = src
+	default:
+		return fmt.Errorf("mongo: cannot scan %T into ObjectId", src)
+	}
+	if len(p) == 12 {
+		*id = ObjectId(p)
+		return nil
+	}
+	return id.UnmarshalText(p)
+}
+
+// Value implements the database/sql/driver Valuer interface. The value is the
+// hexadecimal encoding of the object id or nil for NilObjectId.
+func (id ObjectId) Value() (driver.Value, error) {
+	if id == NilObjectId {
+		return nil, nil
+	}
+	return id.String(), nil
+}
+
+func newObjectId(t time.Time, c uint64) ObjectId {
+	u := t.Unix()
+	b := [12]byte{
+		byte(u >> 24),
+		byte(u >> 16),
+		byte(u >> 8),
+		byte(u),
+		byte(c >> 56),
+		byte(c >> 48),
+		byte(c >> 40),
+		byte(c >> 32),
+		byte(c >> 24),
+		byte(c >> 16),
+		byte(c >> 8),
+		byte(c)}
+	return ObjectId(b[:])
+}
+
+// NewObjectId returns a new object id. The object id has the format specified
+// by MongoDB:
+//
+//	[0:4]  Big endian time since epoch in seconds.
+//	[4:9]  Random value generated once per process.
+//	[9:12] Big endian counter initialized with a random value.
+func NewObjectId() ObjectId {
+	var b [12]byte
+	binary.BigEndian.PutUint32(b[0:4], uint32(time.Now().Unix()))
+	copy(b[4:9], oidProcessUnique[:])
+	c := atomic.AddUint32(&oidCounter, 1)
+	b[9] = byte(c >> 16)
+	b[10] = byte(c >> 8)
+	b[11] = byte(c)
+	return ObjectId(b[:])
+}
+
+// NewObjectIdHex returns an object id initialized from the hexadecimal
+// encoding of the object id.
+func NewObjectIdHex(hexString string) (ObjectId, error) {
+	p, err := hex.DecodeString(hexString)
+	if err != nil {
+		return "", err
+	}
+	if len(p) != 12 {
+		return "", errors.New("mongo: bad object id string len")
+	}
+	return ObjectId(p), nil
+}
+
+// MaxObjectIdForTime returns the maximum object id for time t in seconds from
+// the epoch.
+func MaxObjectIdForTime(t time.Time) ObjectId {
+	return newObjectId(t, 0xffffffffffffffff)
+}
+
+// MinObjectIdForTime returns the minimum object id for time t in seconds from
+// the epoch.
+func MinObjectIdForTime(t time.Time) ObjectId {
+	return newObjectId(t, 0)
+}
+
+// Timestamp returns the time the object id was created in seconds since the
+// epoch. The zero time is returned for invalid object ids.
+func (id ObjectId) Timestamp() time.Time {
+	if len(id) != 12 {
+		return time.Time{}
+	}
+	return time.Unix(int64(binary.BigEndian.Uint32([]byte(id[0:4]))), 0)
+}
+
+// CreationTime extracts the time the object id was created in seconds since the epoch.
+//
+// Deprecated: Use Timestamp.
+func (id ObjectId) CreationTime() time.Time {
+	return id.Timestamp()
+}
+
+var (
+	oidProcessUnique [5]byte
+	oidCounter       uint32
+)
+
+func init() {
+	var b [9]byte
+	if _, err := io.ReadFull(rand.Reader, b[:]); err != nil {
+		panic(err)
+	}
+	copy(oidProcessUnique[:], b[:5])
+	oidCounter = binary.BigEndian.Uint32(b[5:9])
+}
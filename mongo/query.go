@@ -13,7 +13,10 @@
 // under the License.
 
 package mongo
-
+import (
+	"reflect"
+	"time"
+)
 import "reflect"
 
 // Query represents a query to the database.
@@ -143,6 +146,13 @@ func (q *Query) AwaitData(awaitdata bool) *Query {
 	return q
 }
 
+// MaxAwaitTime sets the maximum time that the server waits for new documents
+// on a tailable await cursor returned by CommandCursor.
+func (q *Query) MaxAwaitTime(d time.Duration) *Query {
+	q.Options.MaxAwaitTime = d
+	return q
+}
+
 // commandOptions returns copy of options with values set appropriately for
 // running a command.
 func commandOptions(options *FindOptions) *FindOptions {
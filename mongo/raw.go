@@ -0,0 +1,389 @@
+// Copyright 2011 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package mongo
+
+import (
+	"errors"
+	"iter"
+	"math"
+	"reflect"
+	"time"
+	"unicode/utf8"
+)
+
+// ErrElementNotFound is returned by Raw.LookupErr when the path does not
+// exist in the document.
+var ErrElementNotFound = errors.New("bson: element not found")
+
+// Raw is an encoded BSON document. Use Raw to read fields from a document
+// without decoding the entire document.
+//
+// Raw encodes as an embedded document. A document decodes to Raw by copying
+// the encoded bytes. Arrays do not decode to Raw; use BSONData to capture an
+// array without decoding it.
+//
+// The methods on Raw do not check that the document is well formed beyond
+// what is needed to avoid reading past the end of the data. Call Validate to
+// check a document from an untrusted source.
+type Raw []byte
+
+// RawElement is an element of a raw document.
+type RawElement struct {
+	Key   string
+	Value BSONData
+}
+
+// Lookup returns the value at path in the document. Each element of the path
+// is the key of an element in a document or the index of an element in an
+// array. Lookup returns a value with zero Kind if the path is not found or
+// the document is malformed. Lookup does not allocate memory.
+func (r Raw) Lookup(path ...string) BSONData {
+	bd, _ := r.LookupErr(path...)
+	return bd
+}
+
+// LookupErr returns the value at path in the document. LookupErr returns
+// ErrElementNotFound if the path is not found.
+func (r Raw) LookupErr(path ...string) (bd BSONData, err error) {
+	defer handleAbort(&err)
+	bd = BSONData{Kind: KindDocument, Data: r}
+	for _, key := range path {
+		if bd.Kind != KindDocument && bd.Kind != KindArray {
+			return BSONData{}, ErrElementNotFound
+		}
+		bd = lookupElement(bd.Data, key)
+		if bd.Kind == 0 {
+			return BSONData{}, ErrElementNotFound
+		}
+	}
+	return bd, nil
+}
+
+// lookupElement returns the element with the given key in the encoded
+// document or array doc.
+func lookupElement(doc []byte, key string) BSONData {
+	d := decodeState{data: doc}
+	offset := d.beginDoc()
+	for {
+		kind, name := d.scanKindName()
+		if kind == 0 {
+			break
+		}
+		value := d.scanValue(kind)
+		if string(name) == key {
+			return BSONData{Kind: kind, Data: value}
+		}
+	}
+	d.endDoc(offset)
+	return BSONData{}
+}
+
+// scanValue scans a value of the given kind and returns the encoded value.
+func (d *decodeState) scanValue(kind int) []byte {
+	start := d.offset
+	d.skipValue(kind)
+	if d.offset < start || d.offset > len(d.data) {
+		abort(ErrEOD)
+	}
+	return d.data[start:d.offset]
+}
+
+// All returns an iterator over the keys and values in the document. The
+// iteration stops at the first malformed element. Use Elements to detect
+// errors.
+func (r Raw) All() iter.Seq2[string, BSONData] {
+	return func(yield func(string, BSONData) bool) {
+		r.each(func(key string, bd BSONData) bool {
+			return yield(key, bd)
+		})
+	}
+}
+
+// Elements returns the elements of the document.
+func (r Raw) Elements() ([]RawElement, error) {
+	var elements []RawElement
+	err := r.each(func(key string, bd BSONData) bool {
+		elements = append(elements, RawElement{Key: key, Value: bd})
+		return true
+	})
+	return elements, err
+}
+
+// each calls fn for the elements in the document until fn returns false.
+func (r Raw) each(fn func(string, BSONData) bool) (err error) {
+	defer handleAbort(&err)
+	d := decodeState{data: r}
+	offset := d.beginDoc()
+	for {
+		kind, name := d.scanKindName()
+		if kind == 0 {
+			break
+		}
+		if !fn(string(name), BSONData{Kind: kind, Data: d.scanValue(kind)}) {
+			return nil
+		}
+	}
+	d.endDoc(offset)
+	return nil
+}
+
+// ForEach calls fn for each element in the document. The key is valid only
+// for the duration of the call. If fn returns an error, then ForEach stops
+// and returns the error.
+func (r Raw) ForEach(fn func(key []byte, value BSONData) error) (err error) {
+	defer handleAbort(&err)
+	d := decodeState{data: r}
+	offset := d.beginDoc()
+	for {
+		kind, name := d.scanKindName()
+		if kind == 0 {
+			break
+		}
+		if err := fn(name, BSONData{Kind: kind, Data: d.scanValue(kind)}); err != nil {
+			return err
+		}
+	}
+	d.endDoc(offset)
+	return nil
+}
+
+// Decode decodes the document to v. See the Decode function for more
+// information about BSON decoding.
+func (r Raw) Decode(v interface{}) error {
+	return Decode(r, v)
+}
+
+// String returns the document in relaxed Extended JSON format.
+func (r Raw) String() string {
+	return ExtJSONString(r)
+}
+
+// Validate returns an error if the document is not well formed. The check
+// includes document and string lengths, string termination and encoding,
+// boolean values and element kinds.
+func (r Raw) Validate() (err error) {
+	defer handleAbort(&err)
+	d := decodeState{data: r}
+	d.validateDoc()
+	if d.offset != len(d.data) {
+		return errors.New("bson: extra data after document")
+	}
+	return nil
+}
+
+func (d *decodeState) validateDoc() {
+	start := d.offset
+	offset := d.beginDoc()
+	if offset-start < 5 {
+		abort(errors.New("bson: invalid document length"))
+	}
+	for {
+		kind, name := d.scanKindName()
+		if kind == 0 {
+			break
+		}
+		if !utf8.Valid(name) {
+			abort(errors.New("bson: invalid UTF-8 in key"))
+		}
+		d.validateValue(kind)
+	}
+	d.endDoc(offset)
+}
+
+func (d *decodeState) validateString() {
+	n := int(d.scanInt32())
+	if n < 1 {
+		abort(errors.New("bson: invalid string length"))
+	}
+	p := d.scanSlice(n)
+	if p[n-1] != 0 {
+		abort(errors.New("bson: string not null terminated"))
+	}
+	if !utf8.Valid(p[:n-1]) {
+		abort(errors.New("bson: invalid UTF-8 in string"))
+	}
+}
+
+func (d *decodeState) validateValue(kind int) {
+	switch kind {
+	case KindString, KindSymbol, KindCode:
+		d.validateString()
+	case KindDocument, KindArray:
+		d.validateDoc()
+	case KindCodeWithScope:
+		offset := d.beginDoc()
+		d.validateString()
+		d.validateDoc()
+		d.endDoc(offset)
+	case KindBinary:
+		n := int(d.scanInt32())
+		if n < 0 {
+			abort(errors.New("bson: invalid binary length"))
+		}
+		d.scanByte()
+		d.scanSlice(n)
+	case KindObjectId:
+		d.scanSlice(12)
+	case KindBool:
+		if d.scanByte() > 1 {
+			abort(errors.New("bson: invalid boolean value"))
+		}
+	case KindDateTime, KindTimestamp, KindInt64, KindFloat:
+		d.scanSlice(8)
+	case KindInt32:
+		d.scanSlice(4)
+	case KindDecimal128:
+		d.scanSlice(16)
+	case KindRegexp:
+		d.scanCString()
+		d.scanCString()
+	case KindDBPointer:
+		d.validateString()
+		d.scanSlice(12)
+	case KindMinValue, KindMaxValue, KindNull, KindUndefined:
+	default:
+		abort(&DecodeTypeError{kind})
+	}
+}
+
+// StringOK returns the value of a BSON string. The ok result is false if bd
+// is not a well formed string.
+func (bd BSONData) StringOK() (string, bool) {
+	if bd.Kind != KindString || len(bd.Data) < 5 || int(wire.Uint32(bd.Data)) != len(bd.Data)-4 {
+		return "", false
+	}
+	return string(bd.Data[4 : len(bd.Data)-1]), true
+}
+
+// Int32OK returns the value of a BSON 32-bit integer.
+func (bd BSONData) Int32OK() (int32, bool) {
+	if bd.Kind != KindInt32 || len(bd.Data) != 4 {
+		return 0, false
+	}
+	return int32(wire.Uint32(bd.Data)), true
+}
+
+// Int64OK returns the value of a BSON 64-bit integer.
+func (bd BSONData) Int64OK() (int64, bool) {
+	if bd.Kind != KindInt64 || len(bd.Data) != 8 {
+		return 0, false
+	}
+	return int64(wire.Uint64(bd.Data)), true
+}
+
+// DoubleOK returns the value of a BSON double.
+func (bd BSONData) DoubleOK() (float64, bool) {
+	if bd.Kind != KindFloat || len(bd.Data) != 8 {
+		return 0, false
+	}
+	return math.Float64frombits(wire.Uint64(bd.Data)), true
+}
+
+// BoolOK returns the value of a BSON boolean.
+func (bd BSONData) BoolOK() (bool, bool) {
+	if bd.Kind != KindBool || len(bd.Data) != 1 {
+		return false, false
+	}
+	return bd.Data[0] != 0, true
+}
+
+// DocumentOK returns the value of an embedded document. The returned
+// document shares memory with bd.Data.
+func (bd BSONData) DocumentOK() (Raw, bool) {
+	if bd.Kind != KindDocument {
+		return nil, false
+	}
+	return Raw(bd.Data), true
+}
+
+// ArrayOK returns the value of an array. The keys of the returned document
+// are the array indices. The returned document shares memory with bd.Data.
+func (bd BSONData) ArrayOK() (Raw, bool) {
+	if bd.Kind != KindArray {
+		return nil, false
+	}
+	return Raw(bd.Data), true
+}
+
+// ObjectIdOK returns the value of a BSON object id.
+func (bd BSONData) ObjectIdOK() (ObjectId, bool) {
+	if bd.Kind != KindObjectId || len(bd.Data) != 12 {
+		return "", false
+	}
+	return ObjectId(bd.Data), true
+}
+
+// TimeOK returns the value of a BSON datetime.
+func (bd BSONData) TimeOK() (time.Time, bool) {
+	if bd.Kind != KindDateTime || len(bd.Data) != 8 {
+		return time.Time{}, false
+	}
+	return timeFromMS(int64(wire.Uint64(bd.Data))), true
+}
+
+// TimestampOK returns the value of a BSON timestamp.
+func (bd BSONData) TimestampOK() (Timestamp, bool) {
+	if bd.Kind != KindTimestamp || len(bd.Data) != 8 {
+		return 0, false
+	}
+	return Timestamp(wire.Uint64(bd.Data)), true
+}
+
+// Decimal128OK returns the value of a BSON decimal128.
+func (bd BSONData) Decimal128OK() (Decimal128, bool) {
+	if bd.Kind != KindDecimal128 || len(bd.Data) != 16 {
+		return Decimal128{}, false
+	}
+	return Decimal128{h: wire.Uint64(bd.Data[8:]), l: wire.Uint64(bd.Data[:8])}, true
+}
+
+// BinaryOK returns the value of BSON binary data. The returned data shares
+// memory with bd.Data.
+func (bd BSONData) BinaryOK() (Binary, bool) {
+	if bd.Kind != KindBinary {
+		return Binary{}, false
+	}
+	b, err := scanRawBinary(bd.Data)
+	return b, err == nil
+}
+
+func scanRawBinary(data []byte) (b Binary, err error) {
+	defer handleAbort(&err)
+	d := decodeState{data: data}
+	p, subtype := d.scanBinary()
+	if d.offset != len(d.data) {
+		return Binary{}, ErrEOD
+	}
+	return Binary{Subtype: byte(subtype), Data: p}, nil
+}
+
+func encodeRaw(e *encodeState, name string, fs *fieldSpec, v reflect.Value) {
+	r := v.Interface().(Raw)
+	if len(r) == 0 {
+		return
+	}
+	e.writeKindName(KindDocument, name)
+	e.Write(r)
+}
+
+func decodeRaw(d *decodeState, kind int, v reflect.Value) {
+	// Arrays are rejected because Raw encodes as a document.
+	if kind != KindDocument {
+		d.saveErrorAndSkip(kind, v.Type())
+		return
+	}
+	p := d.scanValue(kind)
+	v.Set(reflect.ValueOf(Raw(append([]byte(nil), p...))))
+}
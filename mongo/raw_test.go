@@ -0,0 +1,211 @@
+// Copyright 2011 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package mongo
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testRaw(t *testing.T) Raw {
+	data, err := Encode(nil, D{
+		{"s", "hello"},
+		{"i", int32(7)},
+		{"l", int64(-8)},
+		{"f", 1.5},
+		{"b", true},
+		{"a", A{"x", D{{"y", int32(9)}}}},
+		{"d", D{{"e", D{{"f", "deep"}}}}},
+		{"t", time.Unix(1, 0)},
+		{"bin", Binary{BinaryOld, []byte{1, 2}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return Raw(data)
+}
+
+func TestRawLookup(t *testing.T) {
+	r := testRaw(t)
+
+	if s, ok := r.Lookup("s").StringOK(); !ok || s != "hello" {
+		t.Errorf("Lookup(s) = %q, %v, want hello, true", s, ok)
+	}
+	if i, ok := r.Lookup("i").Int32OK(); !ok || i != 7 {
+		t.Errorf("Lookup(i) = %d, %v, want 7, true", i, ok)
+	}
+	if l, ok := r.Lookup("l").Int64OK(); !ok || l != -8 {
+		t.Errorf("Lookup(l) = %d, %v, want -8, true", l, ok)
+	}
+	if f, ok := r.Lookup("f").DoubleOK(); !ok || f != 1.5 {
+		t.Errorf("Lookup(f) = %g, %v, want 1.5, true", f, ok)
+	}
+	if b, ok := r.Lookup("b").BoolOK(); !ok || !b {
+		t.Errorf("Lookup(b) = %v, %v, want true, true", b, ok)
+	}
+	if tm, ok := r.Lookup("t").TimeOK(); !ok || !tm.Equal(time.Unix(1, 0)) {
+		t.Errorf("Lookup(t) = %v, %v, want %v, true", tm, ok, time.Unix(1, 0))
+	}
+	if b, ok := r.Lookup("bin").BinaryOK(); !ok || b.Subtype != BinaryOld || string(b.Data) != "\x01\x02" {
+		t.Errorf("Lookup(bin) = %v, %v", b, ok)
+	}
+	if i, ok := r.Lookup("a", "1", "y").Int32OK(); !ok || i != 9 {
+		t.Errorf("Lookup(a, 1, y) = %d, %v, want 9, true", i, ok)
+	}
+	if s, ok := r.Lookup("d", "e", "f").StringOK(); !ok || s != "deep" {
+		t.Errorf("Lookup(d, e, f) = %q, %v, want deep, true", s, ok)
+	}
+	if d, ok := r.Lookup("d").DocumentOK(); !ok || d.Lookup("e", "f").Kind != KindString {
+		t.Errorf("Lookup(d).DocumentOK() = %v, %v", d, ok)
+	}
+	if a, ok := r.Lookup("a").ArrayOK(); !ok || a.Lookup("0").Kind != KindString {
+		t.Errorf("Lookup(a).ArrayOK() = %v, %v", a, ok)
+	}
+	if _, ok := r.Lookup("s").Int32OK(); ok {
+		t.Error("Lookup(s).Int32OK() returned ok")
+	}
+	if bd := r.Lookup(); bd.Kind != KindDocument || string(bd.Data) != string(r) {
+		t.Errorf("Lookup() = %v, want document", bd)
+	}
+
+	for _, path := range [][]string{{"x"}, {"s", "x"}, {"a", "2"}, {"d", "e", "g"}} {
+		if _, err := r.LookupErr(path...); err != ErrElementNotFound {
+			t.Errorf("LookupErr(%v) returned %v, want ErrElementNotFound", path, err)
+		}
+	}
+	if _, err := r[:len(r)-3].LookupErr("x"); err == nil || err == ErrElementNotFound {
+		t.Errorf("LookupErr on truncated document returned %v", err)
+	}
+}
+
+func TestRawLookupAllocs(t *testing.T) {
+	r := testRaw(t)
+	data, err := Encode(nil, D{{"re", Regexp{"^[a-z]+@example\\.com$|^[0-9]{3}-[0-9]{4}$", "i"}}, {"x", D{{"re", Regexp{strings.Repeat("c", 40), ""}}, {"y", int32(1)}}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r2 := Raw(data)
+	n := testing.AllocsPerRun(100, func() {
+		r.Lookup("d", "e", "f")
+		r.Lookup("a", "1", "y")
+		r2.Lookup("x", "y")
+	})
+	if n != 0 {
+		t.Errorf("Lookup allocated %g times, want 0", n)
+	}
+}
+
+func TestRawElements(t *testing.T) {
+	r := testRaw(t)
+	elements, err := r.Elements()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	for key, bd := range r.All() {
+		keys = append(keys, key)
+		if bd.Kind == KindArray {
+			break
+		}
+	}
+	if !reflect.DeepEqual(keys, []string{"s", "i", "l", "f", "b", "a"}) {
+		t.Errorf("All() keys = %v", keys)
+	}
+	if len(elements) != 9 || elements[8].Key != "bin" || elements[8].Value.Kind != KindBinary {
+		t.Errorf("Elements() = %v", elements)
+	}
+	if _, err := r[:len(r)-3].Elements(); err == nil {
+		t.Error("Elements on truncated document did not return error")
+	}
+}
+
+func TestRawEncodeDecode(t *testing.T) {
+	r := testRaw(t)
+	data, err := Encode(nil, M{"r": r})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var v struct {
+		R Raw `bson:"r"`
+	}
+	if err := Decode(data, &v); err != nil {
+		t.Fatal(err)
+	}
+	data[7] = 0xff
+	if string(v.R) != string(r) {
+		t.Errorf("decoded %q, want %q", v.R, r)
+	}
+
+	data, err = Encode(nil, M{"r": A{1, 2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	v.R = nil
+	if err := Decode(data, &v); err == nil {
+		t.Errorf("decoding array to Raw did not return error, decoded %q", v.R)
+	}
+
+	data, err = Encode(nil, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != string(r) {
+		t.Errorf("Encode(r) = %q, want %q", data, r)
+	}
+
+	var m struct {
+		S string `bson:"s"`
+	}
+	if err := r.Decode(&m); err != nil || m.S != "hello" {
+		t.Errorf("Decode() = %v, %q", err, m.S)
+	}
+}
+
+var rawValidateTests = []struct {
+	data  string
+	valid bool
+}{
+	{"\x05\x00\x00\x00\x00", true},
+	{"\x05\x00\x00\x00\x00\x00", false},
+	{"\x04\x00\x00\x00\x00", false},
+	{"\x06\x00\x00\x00\x00", false},
+	{"\x0e\x00\x00\x00\x02a\x00\x02\x00\x00\x00b\x00\x00", true},
+	{"\x0e\x00\x00\x00\x02a\x00\x02\x00\x00\x00bc\x00", false},
+	{"\x0e\x00\x00\x00\x02a\x00\x00\x00\x00\x00\x00\x00", false},
+	{"\x0e\x00\x00\x00\x02a\x00\x02\x00\x00\x00\xff\x00\x00", false},
+	{"\x09\x00\x00\x00\x08a\x00\x01\x00", true},
+	{"\x09\x00\x00\x00\x08a\x00\x02\x00", false},
+	{"\x08\x00\x00\x00\x0aa\x00\x00", true},
+	{"\x08\x00\x00\x00\x42a\x00\x00", false},
+	{"\x0d\x00\x00\x00\x05a\x00\xff\xff\xff\xff\x00\x00", false},
+	{"\x0d\x00\x00\x00\x03a\x00\x05\x00\x00\x00\x00\x00", true},
+	{"\x0d\x00\x00\x00\x03a\x00\x06\x00\x00\x00\x00\x00", false},
+}
+
+func TestRawValidate(t *testing.T) {
+	if err := testRaw(t).Validate(); err != nil {
+		t.Errorf("Validate() returned %v", err)
+	}
+	for _, tt := range rawValidateTests {
+		err := Raw(tt.data).Validate()
+		if tt.valid && err != nil {
+			t.Errorf("Validate(%q) returned %v", tt.data, err)
+		} else if !tt.valid && err == nil {
+			t.Errorf("Validate(%q) did not return error", tt.data)
+		}
+	}
+}
@@ -0,0 +1,280 @@
+// Copyright 2011 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package mongo
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+)
+
+// EncoderFunc returns the value to encode in place of v. If the returned
+// value is nil, then the element is omitted from the document. The value v
+// may not be addressable. The returned value must not have a type that is
+// encoded by the same function.
+type EncoderFunc func(v reflect.Value) (interface{}, error)
+
+// DecoderFunc decodes the BSON value bd to v. The value v is addressable.
+// The function must copy bd.Data if it wishes to retain the data after
+// returning.
+type DecoderFunc func(bd BSONData, v reflect.Value) error
+
+// Registry holds encoders and decoders for types that the application does
+// not control. Registered encoders and decoders take precedence over the
+// built-in encodings and the Marshaler and Unmarshaler interfaces.
+//
+// Use a registry with the EncodeWithOptions and DecodeWithOptions functions
+// or with the Database and Collection WithRegistry methods. A registry is
+// safe for concurrent use.
+type Registry struct {
+	mu         sync.RWMutex
+	types      map[reflect.Type]registryEntry
+	interfaces []registryInterfaceEntry
+	encoders   map[reflect.Type]encoderFunc
+	decoders   map[reflect.Type]decoderFunc
+}
+
+type registryEntry struct {
+	encode EncoderFunc
+	decode DecoderFunc
+}
+
+type registryInterfaceEntry struct {
+	t reflect.Type
+	registryEntry
+}
+
+// NewRegistry returns a new empty registry.
+func NewRegistry() *Registry {
+	return &Registry{types: make(map[reflect.Type]registryEntry)}
+}
+
+// RegisterType registers an encoder and decoder for type t. Either function
+// may be nil. The type t must not be a pointer type; pointers to t are
+// handled by the registration for t.
+func (r *Registry) RegisterType(t reflect.Type, encode EncoderFunc, decode DecoderFunc) {
+	if t.Kind() == reflect.Ptr {
+		panic(errors.New("bson: cannot register pointer type " + t.String()))
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.types[t] = registryEntry{encode, decode}
+	r.encoders, r.decoders = nil, nil
+}
+
+// RegisterInterface registers an encoder and decoder for the types that
+// implement interface type t. Either function may be nil. The decoder is
+// used for target types where the type or a pointer to the type implements
+// t. Type registrations take precedence over interface registrations.
+// Interface registrations are checked in the order registered.
+func (r *Registry) RegisterInterface(t reflect.Type, encode EncoderFunc, decode DecoderFunc) {
+	if t.Kind() != reflect.Interface {
+		panic(errors.New("bson: " + t.String() + " is not an interface type"))
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.interfaces = append(r.interfaces, registryInterfaceEntry{t, registryEntry{encode, decode}})
+	r.encoders, r.decoders = nil, nil
+}
+
+// lookupEncoder returns the registered encoder for type t.
+func (r *Registry) lookupEncoder(t reflect.Type) EncoderFunc {
+	if entry, found := r.types[t]; found {
+		return entry.encode
+	}
+	for _, entry := range r.interfaces {
+		if entry.encode != nil && t.Implements(entry.t) {
+			return entry.encode
+		}
+	}
+	return nil
+}
+
+// lookupDecoder returns the registered decoder for type t.
+func (r *Registry) lookupDecoder(t reflect.Type) DecoderFunc {
+	if entry, found := r.types[t]; found {
+		return entry.decode
+	}
+	for _, entry := range r.interfaces {
+		if entry.decode != nil && (t.Implements(entry.t) || reflect.PtrTo(t).Implements(entry.t)) {
+			return entry.decode
+		}
+	}
+	return nil
+}
+
+// encoder returns the encoder for type t or nil if there is no registered
+// encoder for t.
+func (r *Registry) encoder(t reflect.Type) encoderFunc {
+	r.mu.RLock()
+	encoder, found := r.encoders[t]
+	r.mu.RUnlock()
+	if found {
+		return encoder
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if fn := r.lookupEncoder(t); fn != nil {
+		encoder = func(e *encodeState, name string, fs *fieldSpec, v reflect.Value) {
+			if v.Kind() == reflect.Ptr && v.IsNil() {
+				return
+			}
+			replacement, err := fn(v)
+			if err != nil {
+				abort(&MarshalerError{t, err})
+			}
+			e.encodeValue(name, fs, reflect.ValueOf(replacement))
+		}
+	}
+	if r.encoders == nil {
+		r.encoders = make(map[reflect.Type]encoderFunc)
+	}
+	r.encoders[t] = encoder
+	return encoder
+}
+
+// decoder returns the decoder for type t or nil if there is no registered
+// decoder for t.
+func (r *Registry) decoder(t reflect.Type) decoderFunc {
+	r.mu.RLock()
+	decoder, found := r.decoders[t]
+	r.mu.RUnlock()
+	if found {
+		return decoder
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if fn := r.lookupDecoder(t); fn != nil {
+		decoder = func(d *decodeState, kind int, v reflect.Value) {
+			start := d.offset
+			d.skipValue(kind)
+			if err := fn(BSONData{Kind: kind, Data: d.data[start:d.offset]}, v); err != nil {
+				d.saveError(err)
+			}
+		}
+	}
+	if r.decoders == nil {
+		r.decoders = make(map[reflect.Type]decoderFunc)
+	}
+	r.decoders[t] = decoder
+	return decoder
+}
+
+// NewCodecConn returns a connection that encodes documents sent to conn with
+// the encode options and decodes documents returned from conn with the
+// decode options.
+func NewCodecConn(conn Conn, encodeOptions *EncodeOptions, decodeOptions *DecodeOptions) Conn {
+	return &codecConn{conn, encodeOptions, decodeOptions}
+}
+
+type codecConn struct {
+	Conn
+	encodeOptions *EncodeOptions
+	decodeOptions *DecodeOptions
+}
+
+// encode returns the encoding of doc as BSONData. Nil documents are returned
+// unchanged so that the underlying connection can apply defaults.
+func (c *codecConn) encode(doc interface{}) (interface{}, error) {
+	if doc == nil {
+		return nil, nil
+	}
+	data, err := EncodeWithOptions(nil, doc, c.encodeOptions)
+	if err != nil {
+		return nil, err
+	}
+	return BSONData{Kind: KindDocument, Data: data}, nil
+}
+
+func (c *codecConn) Update(namespace string, selector, update interface{}, options *UpdateOptions) error {
+	selector, err := c.encode(selector)
+	if err != nil {
+		return err
+	}
+	update, err = c.encode(update)
+	if err != nil {
+		return err
+	}
+	return c.Conn.Update(namespace, selector, update, options)
+}
+
+func (c *codecConn) Insert(namespace string, options *InsertOptions, documents ...interface{}) error {
+	encoded := make([]interface{}, len(documents))
+	for i, doc := range documents {
+		var err error
+		encoded[i], err = c.encode(doc)
+		if err != nil {
+			return err
+		}
+	}
+	return c.Conn.Insert(namespace, options, encoded...)
+}
+
+func (c *codecConn) Remove(namespace string, selector interface{}, options *RemoveOptions) error {
+	selector, err := c.encode(selector)
+	if err != nil {
+		return err
+	}
+	return c.Conn.Remove(namespace, selector, options)
+}
+
+func (c *codecConn) Find(namespace string, query interface{}, options *FindOptions) (Cursor, error) {
+	query, err := c.encode(query)
+	if err != nil {
+		return nil, err
+	}
+	if options != nil && options.Fields != nil {
+		o := *options
+		o.Fields, err = c.encode(o.Fields)
+		if err != nil {
+			return nil, err
+		}
+		options = &o
+	}
+	cursor, err := c.Conn.Find(namespace, query, options)
+	if err != nil {
+		return nil, err
+	}
+	return &codecCursor{cursor, c.decodeOptions}, nil
+}
+
+type codecCursor struct {
+	Cursor
+	decodeOptions *DecodeOptions
+}
+
+func (c *codecCursor) Next(value interface{}) error {
+	var bd BSONData
+	if err := c.Cursor.Next(&bd); err != nil {
+		return err
+	}
+	return decodeInternal(bd.Kind, bd.Data, value, c.decodeOptions)
+}
+
+// WithRegistry returns a copy of the database that uses registry r to encode
+// and decode documents.
+func (db Database) WithRegistry(r *Registry) Database {
+	db.Conn = NewCodecConn(db.Conn, &EncodeOptions{Registry: r}, &DecodeOptions{Registry: r})
+	return db
+}
+
+// WithRegistry returns a copy of the collection that uses registry r to
+// encode and decode documents.
+func (c Collection) WithRegistry(r *Registry) Collection {
+	c.Conn = NewCodecConn(c.Conn, &EncodeOptions{Registry: r}, &DecodeOptions{Registry: r})
+	return c
+}
@@ -0,0 +1,174 @@
+// Copyright 2011 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package mongo
+
+import (
+	"encoding"
+	"math/big"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func newTestRegistry() *Registry {
+	r := NewRegistry()
+	r.RegisterType(reflect.TypeOf(time.Duration(0)),
+		func(v reflect.Value) (interface{}, error) {
+			return v.Interface().(time.Duration).String(), nil
+		},
+		func(bd BSONData, v reflect.Value) error {
+			var s string
+			if err := bd.Decode(&s); err != nil {
+				return err
+			}
+			d, err := time.ParseDuration(s)
+			v.SetInt(int64(d))
+			return err
+		})
+	r.RegisterType(reflect.TypeOf(big.Int{}),
+		func(v reflect.Value) (interface{}, error) {
+			i := v.Interface().(big.Int)
+			return i.String(), nil
+		},
+		func(bd BSONData, v reflect.Value) error {
+			var s string
+			if err := bd.Decode(&s); err != nil {
+				return err
+			}
+			v.Addr().Interface().(*big.Int).SetString(s, 10)
+			return nil
+		})
+	r.RegisterInterface(reflect.TypeOf(new(encoding.TextMarshaler)).Elem(),
+		func(v reflect.Value) (interface{}, error) {
+			p, err := v.Interface().(encoding.TextMarshaler).MarshalText()
+			return string(p), err
+		}, nil)
+	r.RegisterInterface(reflect.TypeOf(new(encoding.TextUnmarshaler)).Elem(),
+		nil,
+		func(bd BSONData, v reflect.Value) error {
+			var s string
+			if err := bd.Decode(&s); err != nil {
+				return err
+			}
+			return v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s))
+		})
+	return r
+}
+
+type registryDoc struct {
+	Timeout time.Duration `bson:"timeout"`
+	Count   *big.Int      `bson:"count"`
+	Addr    net.IP        `bson:"addr"`
+	Plain   int           `bson:"plain"`
+}
+
+func TestRegistry(t *testing.T) {
+	r := newTestRegistry()
+	doc := registryDoc{
+		Timeout: 90 * time.Second,
+		Count:   new(big.Int).Lsh(big.NewInt(1), 100),
+		Addr:    net.ParseIP("10.0.0.1"),
+		Plain:   7,
+	}
+	data, err := EncodeWithOptions(nil, &doc, &EncodeOptions{Registry: r})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var m M
+	if err := Decode(data, &m); err != nil {
+		t.Fatal(err)
+	}
+	expected := M{
+		"timeout": "1m30s",
+		"count":   "1267650600228229401496703205376",
+		"addr":    "10.0.0.1",
+		"plain":   7,
+	}
+	if !reflect.DeepEqual(m, expected) {
+		t.Errorf("encoded %v, want %v", m, expected)
+	}
+
+	var doc2 registryDoc
+	if err := DecodeWithOptions(data, &doc2, &DecodeOptions{Registry: r}); err != nil {
+		t.Fatal(err)
+	}
+	if doc2.Timeout != doc.Timeout || doc2.Count.Cmp(doc.Count) != 0 || !doc2.Addr.Equal(doc.Addr) || doc2.Plain != 7 {
+		t.Errorf("decoded %+v, want %+v", doc2, doc)
+	}
+
+	// Without the registry, the duration encodes as an integer.
+	data, err = Encode(nil, M{"timeout": doc.Timeout})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m = nil
+	Decode(data, &m)
+	if m["timeout"] != int64(doc.Timeout) {
+		t.Errorf("timeout = %v, want %d", m["timeout"], int64(doc.Timeout))
+	}
+}
+
+func TestRegistryRegisterPointer(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("RegisterType with pointer type did not panic")
+		}
+	}()
+	NewRegistry().RegisterType(reflect.TypeOf(new(big.Int)), nil, nil)
+}
+
+type recordConn struct {
+	fakeConn
+	inserted []interface{}
+	cursor   *sliceCursor
+}
+
+func (c *recordConn) Insert(namespace string, options *InsertOptions, documents ...interface{}) error {
+	c.inserted = append(c.inserted, documents...)
+	return nil
+}
+
+func (c *recordConn) Find(namespace string, query interface{}, options *FindOptions) (Cursor, error) {
+	return c.cursor, nil
+}
+
+func TestCollectionWithRegistry(t *testing.T) {
+	r := newTestRegistry()
+	conn := &recordConn{cursor: &sliceCursor{docs: []interface{}{M{"timeout": "2s"}}}}
+	c := Collection{Conn: conn, Namespace: "db.c"}.WithRegistry(r)
+
+	if err := c.Insert(M{"timeout": 3 * time.Second}); err != nil {
+		t.Fatal(err)
+	}
+	bd, ok := conn.inserted[0].(BSONData)
+	if !ok {
+		t.Fatalf("inserted %T, want BSONData", conn.inserted[0])
+	}
+	var m M
+	bd.Decode(&m)
+	if m["timeout"] != "3s" {
+		t.Errorf("inserted timeout = %v, want 3s", m["timeout"])
+	}
+
+	var doc registryDoc
+	if err := c.Find(nil).One(&doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc.Timeout != 2*time.Second {
+		t.Errorf("timeout = %v, want 2s", doc.Timeout)
+	}
+}
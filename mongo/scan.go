@@ -0,0 +1,184 @@
+// Copyright 2011 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package mongo
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// Stream decodes the documents in cursor c to values of type T and sends the
+// values on the returned channel. The channel has the given buffer size. When
+// the channel is full, Stream stops reading from the cursor until a receiver
+// is ready.
+//
+// Stream closes the value channel and the cursor when the cursor is
+// exhausted, when a document cannot be decoded or when ctx is done. After the
+// value channel is closed, the error channel receives nil or the error that
+// ended the stream.
+func Stream[T any](ctx context.Context, c Cursor, buffer int) (<-chan T, <-chan error) {
+	values := make(chan T, buffer)
+	errc := make(chan error, 1)
+	go func() {
+		var err error
+		defer func() {
+			c.Close()
+			close(values)
+			errc <- err
+			close(errc)
+		}()
+		for c.HasNext() {
+			var v T
+			if err = c.Next(&v); err != nil {
+				return
+			}
+			select {
+			case values <- v:
+			case <-ctx.Done():
+				err = ctx.Err()
+				return
+			}
+		}
+		if cerr := c.Err(); cerr != nil && cerr != Done {
+			err = cerr
+		}
+	}()
+	return values, errc
+}
+
+// ScanOptions specifies options for the ParallelScan function.
+type ScanOptions struct {
+	// Optional filter applied to the documents in each partition.
+	Filter interface{}
+
+	// Optional document that limits the fields in the returned documents.
+	Fields interface{}
+
+	// Sets the batch size used for sending documents from the server to the
+	// client.
+	BatchSize int
+
+	// The range of object id creation times to scan. If Start is zero, then
+	// the scan starts at the epoch. If End is zero, then the scan ends at the
+	// current time.
+	Start, End time.Time
+
+	// Number of partitions. If zero, then runtime.GOMAXPROCS(0) partitions
+	// are used.
+	Partitions int
+}
+
+// objectIdRanges divides the object ids created in the time range [start,
+// end] into n consecutive ranges. Each range includes the first id and
+// excludes the second id.
+func objectIdRanges(start, end time.Time, n int) [][2]ObjectId {
+	start = start.Truncate(time.Second)
+	end = end.Truncate(time.Second).Add(time.Second)
+	step := end.Sub(start) / time.Duration(n)
+	if step < time.Second {
+		step = time.Second
+	}
+	var ranges [][2]ObjectId
+	for t := start; t.Before(end); {
+		next := t.Add(step).Truncate(time.Second)
+		if len(ranges) == n-1 || !next.Before(end) {
+			next = end
+		}
+		ranges = append(ranges, [2]ObjectId{MinObjectIdForTime(t), MinObjectIdForTime(next)})
+		t = next
+	}
+	return ranges
+}
+
+// ParallelScan scans the collection specified by namespace in parallel. The
+// collection's _id values must be object ids. ParallelScan partitions the
+// collection by _id into ranges of object id creation time and runs a query
+// for each range on a separate connection from pool p. The function fn is
+// called concurrently with the cursor for each partition. The cursor is
+// closed when fn returns.
+//
+// The partitions are selected with the $min and $max query specifiers and an
+// index hint on _id. ParallelScan returns the first error returned by a
+// query or by fn after all partitions are complete.
+func ParallelScan(p *Pool, namespace string, options *ScanOptions, fn func(c Cursor) error) error {
+	var o ScanOptions
+	if options != nil {
+		o = *options
+	}
+	if o.Filter == nil {
+		o.Filter = emptyDoc
+	}
+	if o.Start.IsZero() {
+		o.Start = time.Unix(0, 0)
+	}
+	if o.End.IsZero() {
+		o.End = time.Now()
+	}
+	if o.Partitions <= 0 {
+		o.Partitions = runtime.GOMAXPROCS(0)
+	}
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+	)
+	for _, r := range objectIdRanges(o.Start, o.End, o.Partitions) {
+		wg.Add(1)
+		go func(min, max ObjectId) {
+			defer wg.Done()
+			err := scanPartition(p, namespace, &o, min, max, fn)
+			if err != nil {
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				mu.Unlock()
+			}
+		}(r[0], r[1])
+	}
+	wg.Wait()
+	return firstErr
+}
+
+func scanPartition(p *Pool, namespace string, o *ScanOptions, min, max ObjectId, fn func(c Cursor) error) error {
+	conn, err := p.Get()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	q := Query{
+		Conn:      conn,
+		Namespace: namespace,
+		Spec: QuerySpec{
+			Query: o.Filter,
+			Hint:  D{{"_id", 1}},
+			Min:   D{{"_id", min}},
+			Max:   D{{"_id", max}},
+		},
+		Options: FindOptions{
+			Fields:    o.Fields,
+			BatchSize: o.BatchSize,
+		},
+	}
+	cursor, err := q.Cursor()
+	if err != nil {
+		return err
+	}
+	defer cursor.Close()
+	return fn(cursor)
+}
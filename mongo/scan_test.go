@@ -0,0 +1,167 @@
+// Copyright 2011 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package mongo
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestStream(t *testing.T) {
+	r := &sliceCursor{docs: []interface{}{M{"x": 1}, M{"x": 2}, M{"x": 3}}}
+	values, errc := Stream[iterDoc](context.Background(), r, 0)
+	var xs []int
+	for v := range values {
+		xs = append(xs, v.X)
+	}
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(xs, []int{1, 2, 3}) {
+		t.Errorf("values = %v, want [1 2 3]", xs)
+	}
+	if !r.closed {
+		t.Error("cursor not closed")
+	}
+}
+
+func TestStreamError(t *testing.T) {
+	r := &sliceCursor{docs: []interface{}{M{"x": 1}, M{"x": "bad"}, M{"x": 3}}}
+	values, errc := Stream[iterDoc](context.Background(), r, 3)
+	n := 0
+	for range values {
+		n += 1
+	}
+	if err := <-errc; err == nil {
+		t.Error("expected decode error")
+	}
+	if n != 1 {
+		t.Errorf("received %d values, want 1", n)
+	}
+}
+
+func TestStreamCancel(t *testing.T) {
+	r := &sliceCursor{docs: []interface{}{M{"x": 1}, M{"x": 2}}}
+	ctx, cancel := context.WithCancel(context.Background())
+	values, errc := Stream[iterDoc](ctx, r, 0)
+	<-values
+	cancel()
+	for range values {
+	}
+	if err := <-errc; err != context.Canceled && err != nil {
+		t.Errorf("err = %v, want context.Canceled", err)
+	}
+	if !r.closed {
+		t.Error("cursor not closed")
+	}
+}
+
+func TestObjectIdRanges(t *testing.T) {
+	start := time.Unix(1000, 0)
+	end := time.Unix(1009, 500)
+	ranges := objectIdRanges(start, end, 4)
+	if len(ranges) != 4 {
+		t.Fatalf("got %d ranges, want 4", len(ranges))
+	}
+	if ranges[0][0] != MinObjectIdForTime(start) {
+		t.Errorf("first range starts at %v, want %v", ranges[0][0].CreationTime(), start)
+	}
+	if last := ranges[len(ranges)-1][1]; last != MinObjectIdForTime(time.Unix(1010, 0)) {
+		t.Errorf("last range ends at %v, want 1010", last.CreationTime())
+	}
+	for i := 1; i < len(ranges); i++ {
+		if ranges[i][0] != ranges[i-1][1] {
+			t.Errorf("range %d does not start at end of range %d", i, i-1)
+		}
+	}
+}
+
+type scanConn struct {
+	fakeConn
+	mu      *sync.Mutex
+	queries *[]*QuerySpec
+}
+
+func (c *scanConn) Find(namespace string, query interface{}, options *FindOptions) (Cursor, error) {
+	spec := query.(*QuerySpec)
+	c.mu.Lock()
+	*c.queries = append(*c.queries, spec)
+	c.mu.Unlock()
+	return &sliceCursor{docs: []interface{}{M{"x": 1}}}, nil
+}
+
+func TestParallelScan(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		queries []*QuerySpec
+		conns   int
+	)
+	p := NewPool(func() (Conn, error) {
+		mu.Lock()
+		conns += 1
+		mu.Unlock()
+		return &scanConn{mu: &mu, queries: &queries}, nil
+	}, 4)
+
+	var n int
+	err := ParallelScan(p, "db.coll", &ScanOptions{
+		Start:      time.Unix(0, 0),
+		End:        time.Unix(99, 0),
+		Partitions: 4,
+	}, func(c Cursor) error {
+		for c.HasNext() {
+			var m M
+			if err := c.Next(&m); err != nil {
+				return err
+			}
+			mu.Lock()
+			n += 1
+			mu.Unlock()
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 4 || len(queries) != 4 {
+		t.Fatalf("scanned %d documents with %d queries, want 4 and 4", n, len(queries))
+	}
+	var mins []string
+	for _, q := range queries {
+		mins = append(mins, string(q.Min.(D)[0].Value.(ObjectId)))
+	}
+	sort.Strings(mins)
+	if mins[0] != string(MinObjectIdForTime(time.Unix(0, 0))) {
+		t.Errorf("first partition starts at %v", ObjectId(mins[0]).CreationTime())
+	}
+}
+
+func TestParallelScanError(t *testing.T) {
+	p := NewPool(func() (Conn, error) {
+		return &scanConn{mu: new(sync.Mutex), queries: new([]*QuerySpec)}, nil
+	}, 2)
+	errTest := errors.New("test")
+	err := ParallelScan(p, "db.coll", &ScanOptions{Partitions: 2}, func(c Cursor) error {
+		return errTest
+	})
+	if err != errTest {
+		t.Errorf("ParallelScan returned %v, want %v", err, errTest)
+	}
+}
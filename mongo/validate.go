@@ -0,0 +1,55 @@
+// Copyright 2011 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package mongo
+
+import (
+	"errors"
+	"strings"
+)
+
+// Validate checks that data is a well formed BSON document. Validate checks
+// lengths, terminators, element kinds and that strings and keys are valid
+// UTF-8.
+func Validate(data []byte) error {
+	return Raw(data).Validate()
+}
+
+// ValidateInsert checks that data is a well formed BSON document that can be
+// inserted in a collection. In addition to the checks performed by Validate,
+// ValidateInsert checks that keys in the document and embedded documents do
+// not contain '.' and do not start with '$'. The DBRef keys $ref, $id and $db
+// are allowed in embedded documents.
+func ValidateInsert(data []byte) error {
+	if err := Validate(data); err != nil {
+		return err
+	}
+	return validateInsertKeys(Raw(data), "", true)
+}
+
+func validateInsertKeys(r Raw, path string, topLevel bool) error {
+	return r.ForEach(func(key []byte, value BSONData) error {
+		k := string(key)
+		switch {
+		case strings.Contains(k, "."):
+			return errors.New("bson: key " + path + k + " contains '.'")
+		case strings.HasPrefix(k, "$") && (topLevel || (k != "$ref" && k != "$id" && k != "$db")):
+			return errors.New("bson: key " + path + k + " starts with '$'")
+		}
+		if value.Kind == KindDocument || value.Kind == KindArray {
+			return validateInsertKeys(Raw(value.Data), path+k+".", false)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,53 @@
+// Copyright 2011 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package mongo
+
+import (
+	"testing"
+)
+
+var validateInsertTests = []struct {
+	doc interface{}
+	ok  bool
+}{
+	{M{"a": 1, "b": M{"c": A{M{"d": 1}}}}, true},
+	{M{"a": M{"$ref": "coll", "$id": 1, "$db": "db"}}, true},
+	{M{"a.b": 1}, false},
+	{M{"$set": 1}, false},
+	{M{"$ref": 1}, false},
+	{M{"a": M{"$gt": 1}}, false},
+	{M{"a": A{M{"b.c": 1}}}, false},
+}
+
+func TestValidateInsert(t *testing.T) {
+	for _, tt := range validateInsertTests {
+		data, err := Encode(nil, tt.doc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := Validate(data); err != nil {
+			t.Errorf("Validate(%v) returned %v", tt.doc, err)
+		}
+		err = ValidateInsert(data)
+		if (err == nil) != tt.ok {
+			t.Errorf("ValidateInsert(%v) returned %v, want ok=%v", tt.doc, err, tt.ok)
+		}
+	}
+
+	bad := []byte("\x0c\x00\x00\x00\x10\xff\x00\x01\x00\x00\x00\x00")
+	if err := Validate(bad); err == nil {
+		t.Error("Validate of key with invalid UTF-8 did not return error")
+	}
+}
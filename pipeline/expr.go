@@ -0,0 +1,176 @@
+// Copyright 2011 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package pipeline
+
+import (
+	"github.com/garyburd/go-mongo/mongo"
+)
+
+// Field returns the expression referring to the field at path in the current
+// document.
+func Field(path string) string {
+	return "$" + path
+}
+
+// Var returns the expression referring to the variable name, for example a
+// variable defined with the let option of LookupPipeline.
+func Var(name string) string {
+	return "$$" + name
+}
+
+// Op returns the expression {op: arg}. Use Op for operators that do not have
+// a helper in this package.
+func Op(op string, arg interface{}) mongo.D {
+	return mongo.D{{Key: op, Value: arg}}
+}
+
+func opArgs(op string, args []interface{}) mongo.D {
+	if args == nil {
+		args = []interface{}{}
+	}
+	return Op(op, args)
+}
+
+// Literal returns an expression that evaluates to v without parsing v as an
+// expression.
+func Literal(v interface{}) mongo.D { return Op("$literal", v) }
+
+// Accumulators for Group and Bucket.
+
+// Sum returns a $sum accumulator.
+func Sum(expr interface{}) mongo.D { return Op("$sum", expr) }
+
+// Avg returns an $avg accumulator.
+func Avg(expr interface{}) mongo.D { return Op("$avg", expr) }
+
+// Min returns a $min accumulator.
+func Min(expr interface{}) mongo.D { return Op("$min", expr) }
+
+// Max returns a $max accumulator.
+func Max(expr interface{}) mongo.D { return Op("$max", expr) }
+
+// First returns a $first accumulator.
+func First(expr interface{}) mongo.D { return Op("$first", expr) }
+
+// Last returns a $last accumulator.
+func Last(expr interface{}) mongo.D { return Op("$last", expr) }
+
+// Push returns a $push accumulator.
+func Push(expr interface{}) mongo.D { return Op("$push", expr) }
+
+// AddToSet returns an $addToSet accumulator.
+func AddToSet(expr interface{}) mongo.D { return Op("$addToSet", expr) }
+
+// Arithmetic expressions.
+
+// Add returns an $add expression.
+func Add(args ...interface{}) mongo.D { return opArgs("$add", args) }
+
+// Subtract returns a $subtract expression.
+func Subtract(a, b interface{}) mongo.D { return opArgs("$subtract", []interface{}{a, b}) }
+
+// Multiply returns a $multiply expression.
+func Multiply(args ...interface{}) mongo.D { return opArgs("$multiply", args) }
+
+// Divide returns a $divide expression.
+func Divide(a, b interface{}) mongo.D { return opArgs("$divide", []interface{}{a, b}) }
+
+// Mod returns a $mod expression.
+func Mod(a, b interface{}) mongo.D { return opArgs("$mod", []interface{}{a, b}) }
+
+// Comparison expressions.
+
+// Eq returns an $eq expression.
+func Eq(a, b interface{}) mongo.D { return opArgs("$eq", []interface{}{a, b}) }
+
+// Ne returns a $ne expression.
+func Ne(a, b interface{}) mongo.D { return opArgs("$ne", []interface{}{a, b}) }
+
+// Gt returns a $gt expression.
+func Gt(a, b interface{}) mongo.D { return opArgs("$gt", []interface{}{a, b}) }
+
+// Gte returns a $gte expression.
+func Gte(a, b interface{}) mongo.D { return opArgs("$gte", []interface{}{a, b}) }
+
+// Lt returns an $lt expression.
+func Lt(a, b interface{}) mongo.D { return opArgs("$lt", []interface{}{a, b}) }
+
+// Lte returns an $lte expression.
+func Lte(a, b interface{}) mongo.D { return opArgs("$lte", []interface{}{a, b}) }
+
+// Cmp returns a $cmp expression.
+func Cmp(a, b interface{}) mongo.D { return opArgs("$cmp", []interface{}{a, b}) }
+
+// Boolean and conditional expressions.
+
+// And returns an $and expression.
+func And(args ...interface{}) mongo.D { return opArgs("$and", args) }
+
+// Or returns an $or expression.
+func Or(args ...interface{}) mongo.D { return opArgs("$or", args) }
+
+// Not returns a $not expression.
+func Not(a interface{}) mongo.D { return opArgs("$not", []interface{}{a}) }
+
+// Cond returns a $cond expression that evaluates to then if cond is true and
+// to otherwise if cond is false.
+func Cond(cond, then, otherwise interface{}) mongo.D {
+	return Op("$cond", mongo.D{
+		{Key: "if", Value: cond},
+		{Key: "then", Value: then},
+		{Key: "else", Value: otherwise},
+	})
+}
+
+// IfNull returns an $ifNull expression that evaluates to replacement if expr
+// is null or missing.
+func IfNull(expr, replacement interface{}) mongo.D {
+	return opArgs("$ifNull", []interface{}{expr, replacement})
+}
+
+// String expressions.
+
+// Concat returns a $concat expression.
+func Concat(args ...interface{}) mongo.D { return opArgs("$concat", args) }
+
+// ToLower returns a $toLower expression.
+func ToLower(a interface{}) mongo.D { return Op("$toLower", a) }
+
+// ToUpper returns a $toUpper expression.
+func ToUpper(a interface{}) mongo.D { return Op("$toUpper", a) }
+
+// Array expressions.
+
+// Size returns a $size expression.
+func Size(a interface{}) mongo.D { return Op("$size", a) }
+
+// ArrayElemAt returns an $arrayElemAt expression.
+func ArrayElemAt(a, index interface{}) mongo.D {
+	return opArgs("$arrayElemAt", []interface{}{a, index})
+}
+
+// In returns an $in expression that is true if v is an element of array a.
+func In(v, a interface{}) mongo.D { return opArgs("$in", []interface{}{v, a}) }
+
+// Filter returns a $filter expression that selects the elements of input for
+// which cond is true. The current element is available to cond as the
+// variable as.
+func Filter(input interface{}, as string, cond interface{}) mongo.D {
+	return Op("$filter", mongo.D{
+		{Key: "input", Value: input},
+		{Key: "as", Value: as},
+		{Key: "cond", Value: cond},
+	})
+}
@@ -0,0 +1,241 @@
+// Copyright 2011 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+// Package pipeline builds MongoDB aggregation pipelines.
+//
+// Stage constructors, accumulators and expression helpers in this package
+// return ordinary mongo.D values, so the result can be passed anywhere the
+// mongo package accepts a document:
+//
+//	p := pipeline.New(
+//	    pipeline.Match(mongo.M{"status": "A"}),
+//	    pipeline.Group("$cust_id", mongo.D{{"total", pipeline.Sum("$amount")}}),
+//	    pipeline.Sort(mongo.D{{"total", -1}}))
+//
+//	err := db.Run(mongo.D{{"aggregate", "orders"}, {"pipeline", p}}, &result)
+//
+// More information: http://docs.mongodb.org/manual/reference/aggregation/
+package pipeline
+
+import (
+	"sort"
+
+	"github.com/garyburd/go-mongo/mongo"
+)
+
+// Pipeline is a sequence of aggregation stages. A pipeline encodes as a BSON
+// array of stage documents.
+type Pipeline []mongo.D
+
+// New returns a pipeline with the given stages.
+func New(stages ...mongo.D) Pipeline {
+	return Pipeline(stages)
+}
+
+// Append adds stages to the end of the pipeline.
+func (p *Pipeline) Append(stages ...mongo.D) {
+	*p = append(*p, stages...)
+}
+
+func stage(name string, value interface{}) mongo.D {
+	return mongo.D{{Key: name, Value: value}}
+}
+
+// Match returns a $match stage that passes only the documents matching
+// filter.
+func Match(filter interface{}) mongo.D {
+	return stage("$match", filter)
+}
+
+// Project returns a $project stage. Each element of fields is either an
+// inclusion flag (1 or true), an exclusion flag (0 or false) or an
+// expression computing a new field.
+func Project(fields mongo.D) mongo.D {
+	return stage("$project", fields)
+}
+
+// AddFields returns an $addFields stage that adds the fields computed by the
+// given expressions to each document.
+func AddFields(fields mongo.D) mongo.D {
+	return stage("$addFields", fields)
+}
+
+// Group returns a $group stage that groups documents by the id expression.
+// Each element of fields names an output field and specifies an
+// accumulator, for example {"total", Sum("$amount")}.
+func Group(id interface{}, fields mongo.D) mongo.D {
+	d := make(mongo.D, 0, len(fields)+1)
+	d.Append("_id", id)
+	d = append(d, fields...)
+	return stage("$group", d)
+}
+
+// Sort returns a $sort stage. The order is specified by (key, direction)
+// pairs. The direction is 1 for ascending order and -1 for descending order.
+func Sort(keys mongo.D) mongo.D {
+	return stage("$sort", keys)
+}
+
+// Limit returns a $limit stage.
+func Limit(n int) mongo.D {
+	return stage("$limit", n)
+}
+
+// Skip returns a $skip stage.
+func Skip(n int) mongo.D {
+	return stage("$skip", n)
+}
+
+// ReplaceRoot returns a $replaceRoot stage that replaces each document with
+// the document computed by newRoot.
+func ReplaceRoot(newRoot interface{}) mongo.D {
+	return stage("$replaceRoot", mongo.D{{Key: "newRoot", Value: newRoot}})
+}
+
+// Lookup returns a $lookup stage that performs an equality join between
+// localField in the input documents and foreignField in the documents of the
+// from collection. The matching documents are stored in the array field as.
+func Lookup(from, localField, foreignField, as string) mongo.D {
+	return stage("$lookup", mongo.D{
+		{Key: "from", Value: from},
+		{Key: "localField", Value: localField},
+		{Key: "foreignField", Value: foreignField},
+		{Key: "as", Value: as},
+	})
+}
+
+// LookupPipeline returns a $lookup stage that runs pipeline p on the from
+// collection. The variables in let are available to p.
+func LookupPipeline(from string, let mongo.D, p Pipeline, as string) mongo.D {
+	d := mongo.D{{Key: "from", Value: from}}
+	if let != nil {
+		d.Append("let", let)
+	}
+	if p == nil {
+		p = Pipeline{}
+	}
+	d.Append("pipeline", p)
+	d.Append("as", as)
+	return stage("$lookup", d)
+}
+
+// UnwindOptions specifies options for the Unwind stage.
+type UnwindOptions struct {
+	// Name of a field to hold the array index of the element.
+	IncludeArrayIndex string
+
+	// If true, output a document when the path is null, missing or an empty
+	// array.
+	PreserveNullAndEmptyArrays bool
+}
+
+// Unwind returns an $unwind stage that outputs a document for each element
+// of the array field path. Path must start with "$".
+func Unwind(path string, options *UnwindOptions) mongo.D {
+	if options == nil || (options.IncludeArrayIndex == "" && !options.PreserveNullAndEmptyArrays) {
+		return stage("$unwind", path)
+	}
+	d := mongo.D{{Key: "path", Value: path}}
+	if options.IncludeArrayIndex != "" {
+		d.Append("includeArrayIndex", options.IncludeArrayIndex)
+	}
+	if options.PreserveNullAndEmptyArrays {
+		d.Append("preserveNullAndEmptyArrays", true)
+	}
+	return stage("$unwind", d)
+}
+
+// Facet returns a $facet stage that runs each of the named pipelines on the
+// same input documents. The facets are written in name order.
+func Facet(facets map[string]Pipeline) mongo.D {
+	names := make([]string, 0, len(facets))
+	for name := range facets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	d := make(mongo.D, 0, len(names))
+	for _, name := range names {
+		p := facets[name]
+		if p == nil {
+			p = Pipeline{}
+		}
+		d.Append(name, p)
+	}
+	return stage("$facet", d)
+}
+
+// BucketOptions specifies options for the Bucket stage.
+type BucketOptions struct {
+	// Bucket for documents that do not fall into a boundary. If nil, such
+	// documents cause an error.
+	Default interface{}
+
+	// Accumulators computed for each bucket. If nil, the output contains a
+	// count field.
+	Output mongo.D
+}
+
+// Bucket returns a $bucket stage that groups documents by the groupBy
+// expression into the buckets specified by boundaries.
+func Bucket(groupBy interface{}, boundaries []interface{}, options *BucketOptions) mongo.D {
+	d := mongo.D{{Key: "groupBy", Value: groupBy}, {Key: "boundaries", Value: boundaries}}
+	if options != nil {
+		if options.Default != nil {
+			d.Append("default", options.Default)
+		}
+		if options.Output != nil {
+			d.Append("output", options.Output)
+		}
+	}
+	return stage("$bucket", d)
+}
+
+// GraphLookupOptions specifies options for the GraphLookup stage.
+type GraphLookupOptions struct {
+	// Maximum recursion depth. If nil, the depth is not limited.
+	MaxDepth *int
+
+	// Name of a field added to each matching document with the recursion
+	// depth.
+	DepthField string
+
+	// Additional filter applied to the documents in the from collection.
+	RestrictSearchWithMatch interface{}
+}
+
+// GraphLookup returns a $graphLookup stage that recursively searches the from
+// collection. The search starts with the value of startWith and follows
+// connectFromField to connectToField. The matching documents are stored in
+// the array field as.
+func GraphLookup(from string, startWith interface{}, connectFromField, connectToField, as string, options *GraphLookupOptions) mongo.D {
+	d := mongo.D{
+		{Key: "from", Value: from},
+		{Key: "startWith", Value: startWith},
+		{Key: "connectFromField", Value: connectFromField},
+		{Key: "connectToField", Value: connectToField},
+		{Key: "as", Value: as},
+	}
+	if options != nil {
+		if options.MaxDepth != nil {
+			d.Append("maxDepth", *options.MaxDepth)
+		}
+		if options.DepthField != "" {
+			d.Append("depthField", options.DepthField)
+		}
+		if options.RestrictSearchWithMatch != nil {
+			d.Append("restrictSearchWithMatch", options.RestrictSearchWithMatch)
+		}
+	}
+	return stage("$graphLookup", d)
+}
@@ -0,0 +1,164 @@
+// Copyright 2011 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package pipeline
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/garyburd/go-mongo/mongo"
+)
+
+type M map[string]interface{}
+type A []interface{}
+
+// roundTrip encodes v and decodes the result to generic maps and slices.
+func roundTrip(t *testing.T, v interface{}) interface{} {
+	data, err := mongo.Encode(nil, mongo.M{"v": v})
+	if err != nil {
+		t.Fatalf("Encode(%v) returned error %v", v, err)
+	}
+	var m map[string]interface{}
+	if err := mongo.Decode(data, &m); err != nil {
+		t.Fatalf("Decode returned error %v", err)
+	}
+	return m["v"]
+}
+
+// normalize converts the literal types used in the tests to the types
+// returned by the decoder.
+func normalize(v interface{}) interface{} {
+	switch v := v.(type) {
+	case M:
+		m := make(map[string]interface{})
+		for k, e := range v {
+			m[k] = normalize(e)
+		}
+		return m
+	case A:
+		a := make([]interface{}, len(v))
+		for i, e := range v {
+			a[i] = normalize(e)
+		}
+		return a
+	}
+	return v
+}
+
+var stageTests = []struct {
+	stage    mongo.D
+	expected M
+}{
+	{Match(M{"x": 1}), M{"$match": M{"x": 1}}},
+	{Project(mongo.D{{Key: "x", Value: 1}}), M{"$project": M{"x": 1}}},
+	{AddFields(mongo.D{{Key: "y", Value: Add("$x", 1)}}), M{"$addFields": M{"y": M{"$add": A{"$x", 1}}}}},
+	{
+		Group(Field("state"), mongo.D{{Key: "total", Value: Sum("$pop")}, {Key: "n", Value: Sum(1)}}),
+		M{"$group": M{"_id": "$state", "total": M{"$sum": "$pop"}, "n": M{"$sum": 1}}},
+	},
+	{Sort(mongo.D{{Key: "x", Value: -1}}), M{"$sort": M{"x": -1}}},
+	{Limit(5), M{"$limit": 5}},
+	{Skip(5), M{"$skip": 5}},
+	{ReplaceRoot("$doc"), M{"$replaceRoot": M{"newRoot": "$doc"}}},
+	{
+		Lookup("b", "bid", "_id", "bs"),
+		M{"$lookup": M{"from": "b", "localField": "bid", "foreignField": "_id", "as": "bs"}},
+	},
+	{
+		LookupPipeline("b", mongo.D{{Key: "id", Value: "$_id"}}, New(Match(M{"$expr": Eq("$aid", Var("id"))})), "bs"),
+		M{"$lookup": M{
+			"from":     "b",
+			"let":      M{"id": "$_id"},
+			"pipeline": A{M{"$match": M{"$expr": M{"$eq": A{"$aid", "$$id"}}}}},
+			"as":       "bs"}},
+	},
+	{Unwind("$a", nil), M{"$unwind": "$a"}},
+	{
+		Unwind("$a", &UnwindOptions{IncludeArrayIndex: "i", PreserveNullAndEmptyArrays: true}),
+		M{"$unwind": M{"path": "$a", "includeArrayIndex": "i", "preserveNullAndEmptyArrays": true}},
+	},
+	{
+		Facet(map[string]Pipeline{"a": New(Limit(1)), "b": nil}),
+		M{"$facet": M{"a": A{M{"$limit": 1}}, "b": A{}}},
+	},
+	{
+		Bucket("$price", []interface{}{0, 100}, &BucketOptions{Default: "other", Output: mongo.D{{Key: "n", Value: Sum(1)}}}),
+		M{"$bucket": M{"groupBy": "$price", "boundaries": A{0, 100}, "default": "other", "output": M{"n": M{"$sum": 1}}}},
+	},
+	{
+		GraphLookup("emp", "$boss", "boss", "name", "chain", &GraphLookupOptions{MaxDepth: new(int), DepthField: "d"}),
+		M{"$graphLookup": M{
+			"from":             "emp",
+			"startWith":        "$boss",
+			"connectFromField": "boss",
+			"connectToField":   "name",
+			"as":               "chain",
+			"maxDepth":         0,
+			"depthField":       "d"}},
+	},
+	{
+		Project(mongo.D{{Key: "r", Value: Cond(Gte("$x", 10), "big", IfNull("$y", Literal("$none")))}}),
+		M{"$project": M{"r": M{"$cond": M{
+			"if":   M{"$gte": A{"$x", 10}},
+			"then": "big",
+			"else": M{"$ifNull": A{"$y", M{"$literal": "$none"}}}}}}},
+	},
+	{
+		Project(mongo.D{{Key: "a", Value: Filter("$a", "e", And(Gt("$$e", 1), Not(In("$$e", A{3}))))}}),
+		M{"$project": M{"a": M{"$filter": M{
+			"input": "$a",
+			"as":    "e",
+			"cond":  M{"$and": A{M{"$gt": A{"$$e", 1}}, M{"$not": A{M{"$in": A{"$$e", A{3}}}}}}}}}}},
+	},
+}
+
+func TestStages(t *testing.T) {
+	for _, tt := range stageTests {
+		actual := roundTrip(t, tt.stage)
+		expected := normalize(tt.expected)
+		if !reflect.DeepEqual(actual, expected) {
+			t.Errorf("stage %v\n  encoded %v\n  want    %v", tt.stage, actual, expected)
+		}
+	}
+}
+
+func TestStageOrder(t *testing.T) {
+	stage := Group("$a", mongo.D{{Key: "b", Value: First("$b")}, {Key: "c", Value: Last("$c")}})
+	actual, err := mongo.Encode(nil, stage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, err := mongo.Encode(nil, mongo.D{{Key: "$group", Value: mongo.D{
+		{Key: "_id", Value: "$a"},
+		{Key: "b", Value: mongo.D{{Key: "$first", Value: "$b"}}},
+		{Key: "c", Value: mongo.D{{Key: "$last", Value: "$c"}}}}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(actual, expected) {
+		t.Errorf("Encode(%v) = %q, want %q", stage, actual, expected)
+	}
+}
+
+func TestPipeline(t *testing.T) {
+	p := New(Match(M{"x": 1}))
+	p.Append(Limit(2), Skip(1))
+	actual := roundTrip(t, p)
+	expected := normalize(A{M{"$match": M{"x": 1}}, M{"$limit": 2}, M{"$skip": 1}})
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("pipeline encoded %v, want %v", actual, expected)
+	}
+}